@@ -0,0 +1,54 @@
+package main
+
+import (
+	"time"
+
+	"app_download_analyzer/internal/store"
+)
+
+// appHistoryPayload is /api/app's response: one app's rank and ratings in
+// every snapshot of a chart.
+type appHistoryPayload struct {
+	AppID   string `json:"app_id"`
+	AppName string `json:"app_name"`
+	Country string `json:"country"`
+	Chart   string `json:"chart"`
+	// History has an entry for every snapshot, oldest first; rank is null
+	// where the app was not in the chart.
+	History []appHistoryEntry `json:"history"`
+}
+
+type appHistoryEntry struct {
+	SnapshotID    int64     `json:"snapshot_id"`
+	CollectedAt   time.Time `json:"collected_at"`
+	Rank          *int      `json:"rank"`
+	RatingCount   *int      `json:"rating_count"`
+	AverageRating *float64  `json:"average_rating"`
+}
+
+// newAppHistoryPayload builds the payload from the store's points, naming
+// the app as it was last listed. It reports false when the app is in none
+// of the snapshots.
+func newAppHistoryPayload(country, chart, appID string, points []store.AppHistoryPoint) (appHistoryPayload, bool) {
+	payload := appHistoryPayload{
+		AppID:   appID,
+		Country: country,
+		Chart:   chart,
+		History: make([]appHistoryEntry, 0, len(points)),
+	}
+	found := false
+	for _, point := range points {
+		if point.Rank.Valid {
+			payload.AppName = point.AppName
+			found = true
+		}
+		payload.History = append(payload.History, appHistoryEntry{
+			SnapshotID:    point.ID,
+			CollectedAt:   point.CollectedAt,
+			Rank:          point.Rank.Ptr(),
+			RatingCount:   point.RatingCount.Ptr(),
+			AverageRating: point.AverageRating.Ptr(),
+		})
+	}
+	return payload, found
+}
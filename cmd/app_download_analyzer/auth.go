@@ -0,0 +1,32 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// apiKey is the --api-key flag. When set, API requests must present it in
+// the X-API-Key header or, for clients such as EventSource that cannot set
+// headers, the key query parameter.
+type apiKey string
+
+// wrap rejects requests without the key with 401. With no key configured it
+// returns next unchanged.
+func (k apiKey) wrap(next http.HandlerFunc) http.HandlerFunc {
+	if k == "" {
+		return next
+	}
+	want := []byte(k)
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get("X-API-Key")
+		if got == "" {
+			got = r.URL.Query().Get("key")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `APIKey realm="app_download_analyzer"`)
+			http.Error(w, "missing or invalid API key", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"app_download_analyzer/internal/analysis"
+	"app_download_analyzer/internal/store"
+)
+
+// unclassified labels items stored before themes were persisted.
+const unclassified = "(none)"
+
+func runBackfill(args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	country := fs.String("country", "", "storefront country code (empty for all)")
+	chart := fs.String("chart", "", "chart name (empty for all)")
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	themePath := fs.String("themes", "config/themes.json", "theme rules json to reclassify with")
+	dryRun := fs.Bool("dry-run", false, "report how classifications would change without updating")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	themeContent, err := analysis.ReadThemeConfigContent(*themePath)
+	if err != nil {
+		return err
+	}
+	themeConfig, err := analysis.ParseThemeConfig(themeContent)
+	if err != nil {
+		return fmt.Errorf("theme config %s: %w", *themePath, err)
+	}
+	classifier := analysis.NewThemeClassifier(themeConfig)
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	var themeConfigID int64
+	if !*dryRun {
+		themeConfigID, err = st.SaveThemeConfig(themeContent)
+		if err != nil {
+			return err
+		}
+	}
+
+	summaries, err := st.ListSnapshotSummaries(*country, *chart, 0)
+	if err != nil {
+		return err
+	}
+
+	gained := map[string]int{}
+	lost := map[string]int{}
+	var total, changed, touched int
+	for _, summary := range summaries {
+		items, err := st.GetSnapshotItems(summary.ID)
+		if err != nil {
+			return err
+		}
+		changes := map[string]string{}
+		for _, item := range items {
+			total++
+			theme := classifier.Classify(analysis.ItemThemeInput(item))
+			if theme == item.Theme {
+				continue
+			}
+			previous := item.Theme
+			if previous == "" {
+				previous = unclassified
+			}
+			gained[theme]++
+			lost[previous]++
+			changes[item.AppID] = theme
+		}
+		changed += len(changes)
+		if len(changes) > 0 {
+			touched++
+		}
+		if *dryRun || (len(changes) == 0 && summary.ThemeConfigID == themeConfigID) {
+			continue
+		}
+		if err := st.ReplaceSnapshotThemes(summary.ID, themeConfigID, changes); err != nil {
+			return err
+		}
+	}
+
+	themes := make([]string, 0, len(gained)+len(lost))
+	for theme := range gained {
+		themes = append(themes, theme)
+	}
+	for theme := range lost {
+		if _, ok := gained[theme]; !ok {
+			themes = append(themes, theme)
+		}
+	}
+	sort.Strings(themes)
+	if len(themes) > 0 {
+		fmt.Printf("%-20s %8s %8s\n", "THEME", "GAINED", "LOST")
+		for _, theme := range themes {
+			fmt.Printf("%-20s %8d %8d\n", theme, gained[theme], lost[theme])
+		}
+	}
+
+	verb := "reclassified"
+	if *dryRun {
+		verb = "would reclassify"
+	}
+	fmt.Printf("%s %d of %d items in %d of %d snapshots\n", verb, changed, total, touched, len(summaries))
+	return nil
+}
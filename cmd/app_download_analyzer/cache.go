@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"app_download_analyzer/internal/store"
+)
+
+// reportCache lets clients cache /api/report until its data changes. The
+// report depends on the latest snapshot and the one before it, the rest of
+// the chart's history, the theme config and the server's flags, so those
+// make up its ETag, and a request whose If-None-Match still matches gets a
+// 304 without the report being computed.
+type reportCache struct {
+	// noStore turns caching off: no ETag, and Cache-Control: no-store.
+	noStore bool
+	maxAge  time.Duration
+	// instance changes on every start, since flags such as --rank-weight
+	// change the report without touching the data.
+	instance string
+}
+
+func newReportCache(noStore bool, maxAge time.Duration) *reportCache {
+	return &reportCache{
+		noStore:  noStore,
+		maxAge:   maxAge,
+		instance: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// etag is the validator of a report on latest built with themeContent. It
+// covers the checksums of latest and its previous snapshot, so rewriting
+// either in place (enrichment, a theme backfill, an import with
+// --overwrite) or deleting the previous one changes it, and the chart's
+// snapshot count, which pruning older history changes. It is weak because
+// gzip and identity responses share it.
+func (c *reportCache) etag(ctx context.Context, st *store.Store, latest store.Snapshot, themeContent []byte) (string, error) {
+	latestSum, err := st.SnapshotChecksumContext(ctx, latest.ID)
+	if err != nil {
+		return "", err
+	}
+	var previousID int64
+	var previousSum string
+	previous, err := st.GetPreviousSnapshotContext(ctx, latest.Country, latest.ChartKey(), latest.CollectedAt)
+	switch {
+	case err == nil:
+		previousID = previous.ID
+		if previousSum, err = st.SnapshotChecksumContext(ctx, previous.ID); err != nil {
+			return "", err
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return "", err
+	}
+	count, err := st.CountSnapshotsContext(ctx, latest.Country, latest.ChartKey())
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%s\x00%d\x00%s\x00%d\x00", c.instance, latest.ID, latestSum, previousID, previousSum, count)
+	h.Write(themeContent)
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:12]) + `"`, nil
+}
+
+// check sets the caching headers for a response with the given ETag and
+// reports whether the request already has it, in which case it has
+// answered 304 and the caller must not write a body.
+func (c *reportCache) check(w http.ResponseWriter, r *http.Request, etag string) bool {
+	if c.noStore {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	// private: with --api-key the response must not sit in a shared cache.
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(c.maxAge.Seconds())))
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches applies If-None-Match's weak comparison of a header value,
+// a list of tags or "*", against etag.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"app_download_analyzer/internal/analysis"
+	"app_download_analyzer/internal/store"
+)
+
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fromID := fs.Int64("from", 0, "id of the earlier snapshot")
+	toID := fs.Int64("to", 0, "id of the later snapshot")
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	topN := fs.Int("top", 10, "top N trending apps")
+	themePath := fs.String("themes", "config/themes.json", "theme rules json")
+	rankWeight := fs.Float64("rank-weight", 1.0, "weight for rank delta z-score")
+	reviewWeight := fs.Float64("review-weight", 1.0, "weight for review growth z-score")
+	newEntryBonus := fs.Float64("new-bonus", 0.5, "bonus for new chart entries")
+	ratingAvgWeight := fs.Float64("rating-avg-weight", 0, "weight for average rating delta (0 leaves it out of the score)")
+	launchDays := fs.Int("launch-days", 30, "flag apps released within this many days of the snapshot as launches")
+	normalizePerDay := fs.Bool("normalize-per-day", false, "add each app's rating growth per day between snapshots (display only)")
+	weightedThemes := fs.Bool("weighted-themes", false, "spread apps across all matching themes when scoring momentum")
+	scoreMethodFlag := fs.String("score-method", analysis.ScoreZScore, "delta scoring (zscore, percentile)")
+	reclassify := fs.Bool("reclassify", false, "classify apps with the current theme config instead of the stored themes")
+	granularity := fs.String("granularity", "theme", "momentum grouping (theme, genre)")
+	groupByTheme := fs.Bool("group-by-theme", false, "group trending apps by theme, themes ordered by momentum")
+	format := fs.String("format", formatTable, formatUsage)
+	asJSON := fs.Bool("json", false, "emit the comparison as report JSON")
+	diffOnly := fs.Bool("diff", false, "print the raw entrants, exits and rank moves instead of the scored report")
+	output := registerJSONFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if !analysis.ValidScoreMethod(*scoreMethodFlag) {
+		return fmt.Errorf("unsupported score method: %s", *scoreMethodFlag)
+	}
+
+	if *fromID == 0 || *toID == 0 {
+		return fmt.Errorf("--from and --to are required")
+	}
+	if *granularity != "theme" && *granularity != "genre" {
+		return fmt.Errorf("unsupported granularity: %s", *granularity)
+	}
+	if !validReportFormat(*format) {
+		return fmt.Errorf("unsupported format: %s", *format)
+	}
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	from, err := loadSnapshotByID(st, *fromID)
+	if err != nil {
+		return err
+	}
+	to, err := loadSnapshotByID(st, *toID)
+	if err != nil {
+		return err
+	}
+	if from.Country != to.Country || from.ChartKey() != to.ChartKey() {
+		return fmt.Errorf("snapshots %d (%s %s) and %d (%s %s) are from different charts",
+			from.ID, from.Country, from.ChartKey(), to.ID, to.Country, to.ChartKey())
+	}
+
+	if *diffOnly {
+		diff, err := st.CompareSnapshots(from.ID, to.ID)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return output.writeFile("-", diff)
+		}
+		renderSnapshotDiff(os.Stdout, diff)
+		return nil
+	}
+
+	fromItems, err := st.GetSnapshotItems(from.ID)
+	if err != nil {
+		return err
+	}
+	toItems, err := st.GetSnapshotItems(to.ID)
+	if err != nil {
+		return err
+	}
+	themeConfig, err := analysis.LoadThemeConfig(*themePath)
+	if err != nil {
+		return err
+	}
+
+	cfg := analysis.TrendConfig{
+		RankWeight:      *rankWeight,
+		ReviewWeight:    *reviewWeight,
+		NewEntryBonus:   *newEntryBonus,
+		RatingAvgWeight: *ratingAvgWeight,
+		LaunchWindow:    time.Duration(*launchDays) * 24 * time.Hour,
+		NormalizePerDay: *normalizePerDay,
+		WeightedThemes:  *weightedThemes,
+		ScoreMethod:     *scoreMethodFlag,
+		Reclassify:      *reclassify,
+	}
+	payload, err := buildReport(context.Background(), st, to, from, toItems, fromItems, cfg, themeConfig)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return output.writeFile("-", payload)
+	}
+	return renderReport(os.Stdout, payload, *format, renderOptions{TopN: *topN, GroupByTheme: *groupByTheme, Granularity: *granularity})
+}
+
+func loadSnapshotByID(st *store.Store, id int64) (store.Snapshot, error) {
+	snapshot, err := st.GetSnapshotByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return store.Snapshot{}, fmt.Errorf("snapshot %d not found", id)
+	}
+	return snapshot, err
+}
+
+func renderSnapshotDiff(w io.Writer, diff store.SnapshotDiff) {
+	fmt.Fprintf(w, "Snapshot %d -> %d\n", diff.FromID, diff.ToID)
+	if diff.Empty() {
+		fmt.Fprintf(w, "No changes (%d apps at the same rank)\n", diff.Unchanged)
+		return
+	}
+	fmt.Fprintf(w, "\nEntered (%d):\n", len(diff.Entrants))
+	for _, entry := range diff.Entrants {
+		fmt.Fprintf(w, "  #%d %s\n", entry.Rank, entry.AppName)
+	}
+	fmt.Fprintf(w, "\nExited (%d):\n", len(diff.Exits))
+	for _, entry := range diff.Exits {
+		fmt.Fprintf(w, "  was #%d %s\n", entry.Rank, entry.AppName)
+	}
+	fmt.Fprintf(w, "\nMoved (%d):\n", len(diff.Moves))
+	for _, move := range diff.Moves {
+		fmt.Fprintf(w, "  #%d %s (was #%d, %+d)\n", move.ToRank, move.AppName, move.FromRank, move.FromRank-move.ToRank)
+	}
+	fmt.Fprintf(w, "\nUnchanged: %d\n", diff.Unchanged)
+}
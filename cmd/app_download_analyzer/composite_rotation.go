@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"app_download_analyzer/internal/analysis"
+	"app_download_analyzer/internal/store"
+)
+
+func runCompositeRotation(args []string) error {
+	fs := flag.NewFlagSet("composite-rotation", flag.ExitOnError)
+	country := fs.String("country", defaultCountry, "storefront country code")
+	charts := fs.String("charts", "top-free,top-paid,top-grossing", "comma-separated charts to combine")
+	weights := fs.String("weights", "top-free=1,top-paid=1,top-grossing=2", "per-chart weights (chart=weight, comma-separated)")
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	themePath := fs.String("themes", "config/themes.json", "theme rules json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	chartWeights, err := parseWeights(*weights)
+	if err != nil {
+		return err
+	}
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	cfg := analysis.TrendConfig{RankWeight: 1.0, ReviewWeight: 1.0, NewEntryBonus: 0.5}
+	indexes := map[string]float64{}
+	var order []string
+	for _, chart := range splitCSV(*charts) {
+		payload, err := computeReport(context.Background(), st, *country, chart, themeFile(*themePath), cfg, reportOptions{})
+		if err != nil {
+			slog.Warn("skipping chart", "country", *country, "chart", chart, "err", err)
+			continue
+		}
+		indexes[chart] = payload.RotationIndex
+		order = append(order, chart)
+	}
+	if len(indexes) == 0 {
+		return fmt.Errorf("no chart data for %s", *country)
+	}
+
+	fmt.Printf("Composite rotation (%s):\n", *country)
+	for _, chart := range order {
+		weight, ok := chartWeights[chart]
+		if !ok {
+			weight = 1
+		}
+		fmt.Printf("  %s: %.2f (weight %.2f)\n", chart, indexes[chart], weight)
+	}
+	fmt.Println()
+	fmt.Printf("Composite rotation index: %.2f\n", analysis.CompositeRotation(indexes, chartWeights))
+	return nil
+}
+
+// parseWeights parses "a=1,b=2.5" into a map.
+func parseWeights(value string) (map[string]float64, error) {
+	weights := map[string]float64{}
+	for _, part := range splitCSV(value) {
+		key, raw, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid weight %q (want name=value)", part)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight %q: %w", part, err)
+		}
+		weights[strings.TrimSpace(key)] = weight
+	}
+	return weights, nil
+}
+
+// splitCSV splits a comma-separated flag value, dropping empty entries.
+func splitCSV(value string) []string {
+	var out []string
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// parseFlags parses args like fs.Parse, adding a --config flag that names a
+// JSON file of flag defaults and the --log-level and --log-format flags.
+// Precedence is built-in default < config file < command-line flag. The
+// default logger is set up once the flags are known.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	configPath := fs.String("config", "", "JSON file of flag defaults (command-line flags override it)")
+	logging := registerLogFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var unknown []string
+	if *configPath != "" {
+		config, err := loadConfig(*configPath, fs.Name())
+		if err != nil {
+			return err
+		}
+		if unknown, err = applyConfig(fs, config); err != nil {
+			return err
+		}
+	}
+	if err := logging.apply(); err != nil {
+		return err
+	}
+	// Warn only now, so the warnings honour the config's own log settings.
+	for _, key := range unknown {
+		slog.Warn("unknown config key ignored", "config", *configPath, "key", key)
+	}
+	return nil
+}
+
+// fileConfig is the part of a config file that concerns one command.
+type fileConfig struct {
+	// shared holds the top-level values, meant for every command with a
+	// flag of that name.
+	shared map[string]string
+	// section holds the values of the command's own section, which take
+	// precedence over shared ones.
+	section map[string]string
+	// unknownSections are top-level objects not named after any command.
+	unknownSections []string
+}
+
+// loadConfig reads a config file and returns the flag values for command.
+// Top-level keys are flag names shared by every command; an object keyed by
+// a command name overrides them for that command only:
+//
+//	{"db": "data/appstore.db", "country": "kr", "serve": {"interval": "6h"}}
+//
+// Lists are joined with commas, matching the comma-separated flags.
+func loadConfig(path, command string) (fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileConfig{}, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fileConfig{}, fmt.Errorf("config %s: %w", path, err)
+	}
+
+	config := fileConfig{shared: map[string]string{}, section: map[string]string{}}
+	known := commands()
+	var section map[string]json.RawMessage
+	for key, value := range raw {
+		if key == command {
+			if err := json.Unmarshal(value, &section); err != nil {
+				return fileConfig{}, fmt.Errorf("config %s: %q must be an object: %w", path, key, err)
+			}
+			continue
+		}
+		if isCommandSection(value) {
+			if _, ok := known[key]; !ok {
+				config.unknownSections = append(config.unknownSections, key)
+			}
+			continue
+		}
+		text, err := configValue(value)
+		if err != nil {
+			return fileConfig{}, fmt.Errorf("config %s: %s: %w", path, key, err)
+		}
+		config.shared[key] = text
+	}
+	for key, value := range section {
+		text, err := configValue(value)
+		if err != nil {
+			return fileConfig{}, fmt.Errorf("config %s: %s.%s: %w", path, command, key, err)
+		}
+		config.section[key] = text
+	}
+	sort.Strings(config.unknownSections)
+	return config, nil
+}
+
+func isCommandSection(value json.RawMessage) bool {
+	return strings.HasPrefix(strings.TrimSpace(string(value)), "{")
+}
+
+func configValue(value json.RawMessage) (string, error) {
+	var decoded any
+	if err := json.Unmarshal(value, &decoded); err != nil {
+		return "", err
+	}
+	switch v := decoded.(type) {
+	case string:
+		return v, nil
+	case bool, float64:
+		return fmt.Sprint(v), nil
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case string, bool, float64:
+				parts = append(parts, fmt.Sprint(item))
+			default:
+				return "", fmt.Errorf("list items must be strings, numbers or booleans")
+			}
+		}
+		return strings.Join(parts, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %s", value)
+	}
+}
+
+// applyConfig sets every config value whose flag was not given on the
+// command line. Top-level keys that are not flags of this command are
+// skipped, so one file can serve several commands, but a key in the
+// command's own section must be one of its flags. It returns the keys it
+// ignored for that reason, along with sections named after no command, so
+// typos don't go unnoticed.
+func applyConfig(fs *flag.FlagSet, config fileConfig) ([]string, error) {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	values := map[string]string{}
+	for key, value := range config.shared {
+		if fs.Lookup(key) != nil {
+			values[key] = value
+		}
+	}
+	var unknown []string
+	for key, value := range config.section {
+		if fs.Lookup(key) == nil {
+			unknown = append(unknown, fs.Name()+"."+key)
+			continue
+		}
+		values[key] = value
+	}
+	sort.Strings(unknown)
+	unknown = append(unknown, config.unknownSections...)
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == "config" || explicit[key] {
+			continue
+		}
+		if err := fs.Set(key, values[key]); err != nil {
+			return nil, fmt.Errorf("config value for --%s: %w", key, err)
+		}
+	}
+	return unknown, nil
+}
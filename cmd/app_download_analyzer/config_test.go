@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConfigScopesSections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `{"db": "shared.db", "interval": "1h", "list": {"limit": 5, "limt": 6}, "lsit": {"json": true}, "serve": {"db": "serve.db"}}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	db := fs.String("db", "default.db", "")
+	limit := fs.Int("limit", 20, "")
+	country := fs.String("country", "kr", "")
+	if err := fs.Parse([]string{"--country", "us"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig(path, "list")
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	unknown, err := applyConfig(fs, config)
+	if err != nil {
+		t.Fatalf("applyConfig: %v", err)
+	}
+	if *db != "shared.db" || *limit != 5 || *country != "us" {
+		t.Errorf("db, limit, country = %q, %d, %q; want shared.db, 5, us", *db, *limit, *country)
+	}
+	// interval is shared with serve and not a mistake; the section typo and
+	// the misspelt command are.
+	if want := []string{"list.limt", "lsit"}; !reflect.DeepEqual(unknown, want) {
+		t.Errorf("unknown keys = %v, want %v", unknown, want)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	corsAllowMethods = "GET, POST, OPTIONS"
+	corsAllowHeaders = "Accept, Content-Type, X-API-Key"
+	// corsExposeHeaders lets browser clients read the paging total.
+	corsExposeHeaders = totalCountHeader
+)
+
+// corsOrigins is the --cors-origin flag: origins allowed to call the API
+// from a browser. It may be repeated or comma-separated; "*" allows any
+// origin. Empty disables CORS headers entirely.
+type corsOrigins []string
+
+func (o *corsOrigins) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *corsOrigins) Set(value string) error {
+	*o = append(*o, splitCSV(value)...)
+	return nil
+}
+
+// allowed returns the Access-Control-Allow-Origin value for origin, or ""
+// when it is not allowed.
+func (o corsOrigins) allowed(origin string) string {
+	for _, candidate := range o {
+		if candidate == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(candidate, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// wrap adds CORS headers to next's responses and answers preflight requests
+// itself. With no origins configured it returns next unchanged.
+func (o corsOrigins) wrap(next http.HandlerFunc) http.HandlerFunc {
+	if len(o) == 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		allow := o.allowed(r.Header.Get("Origin"))
+		if allow != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allow)
+			w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allow != "" {
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				w.Header().Set("Access-Control-Max-Age", "600")
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"app_download_analyzer/internal/store"
+)
+
+// rankDiffPayload is the diff command's JSON output.
+type rankDiffPayload struct {
+	Latest   reportSnapshot     `json:"latest"`
+	Baseline reportSnapshot     `json:"baseline"`
+	Climbed  []store.RankChange `json:"climbed"`
+	Fell     []store.RankChange `json:"fell"`
+	Entered  []store.DiffEntry  `json:"entered"`
+	Exited   []store.DiffEntry  `json:"exited"`
+}
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	country := fs.String("country", defaultCountry, "storefront country code")
+	chart := fs.String("chart", defaultChart, chartUsage)
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	date := fs.String("date", "", "compare the latest snapshot with the one nearest this time (RFC3339 or YYYY-MM-DD)")
+	tz := fs.String("tz", "", tzDateUsage)
+	topN := fs.Int("top", 10, "apps to list per section (0 for all)")
+	asJSON := fs.Bool("json", false, "emit the diff as JSON")
+	output := registerJSONFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *date == "" {
+		return fmt.Errorf("--date is required")
+	}
+	loc, err := seriesLocation(*tz, *country)
+	if err != nil {
+		return err
+	}
+	target, err := parseTimeArg(*date, loc)
+	if err != nil {
+		return fmt.Errorf("invalid --date: %w", err)
+	}
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	latest, err := st.GetLatestSnapshot(*country, *chart)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no snapshots for %s/%s", *country, *chart)
+	}
+	if err != nil {
+		return err
+	}
+	baseline, err := st.GetSnapshotNearestTime(*country, *chart, target)
+	if err != nil {
+		return err
+	}
+	if baseline.ID == latest.ID {
+		return fmt.Errorf("the snapshot nearest %s is the latest one (%s); nothing to compare",
+			*date, latest.CollectedAt.Format(time.RFC3339))
+	}
+
+	diff, err := st.CompareSnapshots(baseline.ID, latest.ID)
+	if err != nil {
+		return err
+	}
+	payload := rankDiffPayload{
+		Latest:   newReportSnapshot(latest),
+		Baseline: newReportSnapshot(baseline),
+		Climbed:  []store.RankChange{},
+		Fell:     []store.RankChange{},
+		Entered:  diff.Entrants,
+		Exited:   diff.Exits,
+	}
+	for _, move := range diff.Moves {
+		if move.ToRank < move.FromRank {
+			payload.Climbed = append(payload.Climbed, move)
+		} else {
+			payload.Fell = append(payload.Fell, move)
+		}
+	}
+	sortByMagnitude(payload.Climbed)
+	sortByMagnitude(payload.Fell)
+	if payload.Entered == nil {
+		payload.Entered = []store.DiffEntry{}
+	}
+	if payload.Exited == nil {
+		payload.Exited = []store.DiffEntry{}
+	}
+
+	if *asJSON {
+		return output.writeFile("-", payload)
+	}
+	renderRankDiff(os.Stdout, payload, *topN)
+	return nil
+}
+
+// sortByMagnitude orders moves by the size of the rank change, largest
+// first, then by current rank.
+func sortByMagnitude(moves []store.RankChange) {
+	magnitude := func(move store.RankChange) int {
+		if move.FromRank > move.ToRank {
+			return move.FromRank - move.ToRank
+		}
+		return move.ToRank - move.FromRank
+	}
+	sort.SliceStable(moves, func(i, j int) bool {
+		if magnitude(moves[i]) != magnitude(moves[j]) {
+			return magnitude(moves[i]) > magnitude(moves[j])
+		}
+		return moves[i].ToRank < moves[j].ToRank
+	})
+}
+
+func renderRankDiff(w io.Writer, payload rankDiffPayload, topN int) {
+	fmt.Fprintf(w, "Latest snapshot: %s (%s %s)%s\n", payload.Latest.CollectedAt.Format(time.RFC3339), payload.Latest.Country, store.ChartKey(payload.Latest.Chart, payload.Latest.Genre), tagSuffix(payload.Latest.Tag))
+	fmt.Fprintf(w, "Compared with: %s%s\n", payload.Baseline.CollectedAt.Format(time.RFC3339), tagSuffix(payload.Baseline.Tag))
+
+	section := func(title string, n int, line func(i int) string) {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "%s (%d):\n", title, n)
+		for i := 0; i < n; i++ {
+			if topN > 0 && i >= topN {
+				fmt.Fprintf(w, "    ... and %d more\n", n-topN)
+				break
+			}
+			fmt.Fprintf(w, "%2d. %s\n", i+1, line(i))
+		}
+	}
+	section("Climbed", len(payload.Climbed), func(i int) string {
+		move := payload.Climbed[i]
+		return fmt.Sprintf("#%d %s (was #%d, %+d)", move.ToRank, move.AppName, move.FromRank, move.FromRank-move.ToRank)
+	})
+	section("Fell", len(payload.Fell), func(i int) string {
+		move := payload.Fell[i]
+		return fmt.Sprintf("#%d %s (was #%d, %+d)", move.ToRank, move.AppName, move.FromRank, move.FromRank-move.ToRank)
+	})
+	section("Entered", len(payload.Entered), func(i int) string {
+		entry := payload.Entered[i]
+		return fmt.Sprintf("#%d %s", entry.Rank, entry.AppName)
+	})
+	section("Exited", len(payload.Exited), func(i int) string {
+		entry := payload.Exited[i]
+		return fmt.Sprintf("%s (was #%d)", entry.AppName, entry.Rank)
+	})
+}
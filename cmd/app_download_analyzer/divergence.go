@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"app_download_analyzer/internal/analysis"
+	"app_download_analyzer/internal/store"
+)
+
+func runDivergence(args []string) error {
+	fs := flag.NewFlagSet("divergence", flag.ExitOnError)
+	country := fs.String("country", defaultCountry, "storefront country code")
+	chart := fs.String("chart", defaultChart, chartUsage)
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	themePath := fs.String("themes", "config/themes.json", "theme rules json")
+	threshold := fs.Float64("threshold", 1.0, "minimum absolute z-score for both rank and review signals")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	payload, err := computeReport(context.Background(), st, *country, *chart, themeFile(*themePath), analysis.TrendConfig{
+		RankWeight:   1.0,
+		ReviewWeight: 1.0,
+	}, reportOptions{})
+	if err != nil {
+		return err
+	}
+
+	divergences := analysis.FindDivergences(payload.Trends, *threshold)
+	fmt.Printf("Latest snapshot: %s (%s %s)\n", payload.Latest.CollectedAt.Format(time.RFC3339), payload.Latest.Country, payload.Latest.Chart)
+	fmt.Println()
+	if len(divergences) == 0 {
+		fmt.Printf("No divergent apps (threshold %.2f).\n", *threshold)
+		return nil
+	}
+
+	fmt.Println("Divergent apps:")
+	for i, item := range divergences {
+		fmt.Printf("%2d. #%d %s (%s) rank z %+.2f review z %+.2f [%s]\n",
+			i+1, item.Rank, item.AppName, item.Theme, item.RankZ, item.ReviewZ, item.Direction)
+	}
+	return nil
+}
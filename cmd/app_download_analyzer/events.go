@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// fetchEvent is published to /api/events subscribers after each stored snapshot.
+type fetchEvent struct {
+	SnapshotID  int64     `json:"snapshot_id"`
+	Count       int       `json:"count"`
+	Country     string    `json:"country"`
+	Chart       string    `json:"chart"`
+	CollectedAt time.Time `json:"collected_at"`
+	// Duplicate marks a fetch that matched the latest snapshot and was not
+	// stored; SnapshotID is then that existing snapshot.
+	Duplicate bool `json:"duplicate,omitempty"`
+}
+
+// eventBroker fans fetch events out to server-sent event subscribers.
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan fetchEvent]struct{}
+	// done is closed on server shutdown to end open streams, which
+	// http.Server.Shutdown would otherwise wait on until its deadline.
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscribers: map[chan fetchEvent]struct{}{}, done: make(chan struct{})}
+}
+
+// close ends every open stream and makes new ones return at once. It is
+// registered with http.Server.RegisterOnShutdown.
+func (b *eventBroker) close() {
+	b.closeOnce.Do(func() { close(b.done) })
+}
+
+func (b *eventBroker) subscribe() chan fetchEvent {
+	ch := make(chan fetchEvent, 8)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *eventBroker) unsubscribe(ch chan fetchEvent) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+}
+
+// publish delivers event to every subscriber, dropping it for clients whose
+// buffer is full rather than blocking the fetch loop.
+func (b *eventBroker) publish(event fetchEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (b *eventBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	// The stream stays open indefinitely, so lift the server's write
+	// timeout for it.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ch := b.subscribe()
+	defer b.unsubscribe(ch)
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-b.done:
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event := <-ch:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: fetch\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
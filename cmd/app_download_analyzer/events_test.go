@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventBrokerStreamsAndEndsOnShutdown(t *testing.T) {
+	broker := newEventBroker()
+	srv := httptest.NewUnstartedServer(broker)
+	srv.Config.RegisterOnShutdown(broker.close)
+	srv.Start()
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	// The subscription is made after the headers are flushed; wait for it
+	// so the event is not published to nobody.
+	for deadline := time.Now().Add(time.Second); ; {
+		broker.mu.Lock()
+		n := len(broker.subscribers)
+		broker.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("client never subscribed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	broker.publish(fetchEvent{SnapshotID: 7, Count: 25, Country: "kr", Chart: "top-free"})
+	body := bufio.NewReader(res.Body)
+	line, err := body.ReadString('\n')
+	if err != nil || line != "event: fetch\n" {
+		t.Fatalf("first line = %q, %v", line, err)
+	}
+	if line, _ := body.ReadString('\n'); !strings.Contains(line, `"snapshot_id":7`) {
+		t.Errorf("data line = %q", line)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := srv.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown with an open stream: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown took %v", elapsed)
+	}
+
+}
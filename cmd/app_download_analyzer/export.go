@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"app_download_analyzer/internal/analysis"
+	"app_download_analyzer/internal/store"
+)
+
+var exportHeader = []string{"collected_at", "country", "chart", "rank", "app_id", "app_name", "theme", "rating_count", "average_rating"}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	country := fs.String("country", "", "storefront country code (empty for all)")
+	chart := fs.String("chart", "", "chart name (empty for all)")
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	themePath := fs.String("themes", "config/themes.json", "theme rules json")
+	since := fs.String("since", "", "only snapshots collected at or after this time (RFC3339 or YYYY-MM-DD)")
+	until := fs.String("until", "", "only snapshots collected at or before this time (RFC3339 or YYYY-MM-DD, whole day)")
+	tz := fs.String("tz", "", tzDateUsage)
+	outPath := fs.String("out", "-", "output CSV path or '-' for stdout")
+	reclassify := fs.Bool("reclassify", false, "classify apps with the current theme config instead of the stored themes")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	loc, err := seriesLocation(*tz, *country)
+	if err != nil {
+		return err
+	}
+	sinceTime, untilTime, err := parseTimeRange(*since, *until, loc)
+	if err != nil {
+		return err
+	}
+
+	themeConfig, err := analysis.LoadThemeConfig(*themePath)
+	if err != nil {
+		return err
+	}
+	classifier := analysis.NewThemeClassifier(themeConfig)
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	var out io.Writer = os.Stdout
+	if *outPath != "-" {
+		if err := ensureDirForFile(*outPath); err != nil {
+			return err
+		}
+		file, err := os.Create(*outPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	w := csv.NewWriter(out)
+	if err := w.Write(exportHeader); err != nil {
+		return err
+	}
+	rows := 0
+	err = st.EachChartItem(*country, *chart, sinceTime, untilTime, func(snapshot store.Snapshot, item store.ChartItem) error {
+		theme := classifier.ClassifyItem(item, *reclassify)
+		rows++
+		return w.Write([]string{
+			snapshot.CollectedAt.Format(time.RFC3339),
+			snapshot.Country,
+			snapshot.ChartKey(),
+			strconv.Itoa(item.Rank),
+			item.AppID,
+			item.AppName,
+			theme,
+			formatNullInt(item.RatingCount),
+			formatNullFloat(item.AverageRating),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if *outPath != "-" {
+		fmt.Printf("wrote %d rows to %s\n", rows, *outPath)
+	}
+	return nil
+}
+
+func formatNullInt(value store.NullInt) string {
+	if !value.Valid {
+		return ""
+	}
+	return strconv.Itoa(value.Value)
+}
+
+func formatNullFloat(value store.NullFloat) string {
+	if !value.Valid {
+		return ""
+	}
+	return strconv.FormatFloat(value.Value, 'f', -1, 64)
+}
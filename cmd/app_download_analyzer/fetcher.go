@@ -2,56 +2,82 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
+	"app_download_analyzer/internal/analysis"
 	"app_download_analyzer/internal/apple"
 	"app_download_analyzer/internal/store"
 )
 
-func fetchSnapshot(ctx context.Context, client *http.Client, st *store.Store, country, chart string, limit int, noItunes bool) (int64, int, error) {
-	if !apple.ValidChart(chart) {
-		return 0, 0, fmt.Errorf("unsupported chart: %s", chart)
+// newAppleClient builds the Apple client used by fetch and serve. Lookups
+// run concurrency requests at a time, started at least delay apart and
+// paced to perMinute (0 for no limit), and ask for results in lang when it
+// is set.
+func newAppleClient(timeout time.Duration, concurrency, perMinute int, delay time.Duration, lang string) *apple.Client {
+	client := apple.NewClient(&http.Client{Timeout: timeout})
+	client.LookupConcurrency = concurrency
+	client.Limiter = apple.NewRateLimiter(perMinute, concurrency)
+	client.LookupDelay = delay
+	client.Lang = lang
+	return client
+}
+
+// fetchedSnapshot is the outcome of fetchSnapshot. Duplicate means the feed
+// had not changed since the latest stored snapshot, so nothing was inserted
+// and SnapshotID and Count describe that existing snapshot.
+type fetchedSnapshot struct {
+	SnapshotID int64
+	Count      int
+	Duplicate  bool
+}
+
+// fetchSnapshot fetches and stores one chart; chartKey may name a
+// genre-scoped chart (see store.ChartKey). cache, when non-nil, shares
+// iTunes lookups with other charts fetched in the same run. Unless force is
+// set, a chart identical to the latest stored one is skipped.
+func fetchSnapshot(ctx context.Context, client *apple.Client, st *store.Store, country, chartKey string, limit int, noItunes, force bool, themes themeSource, cache *itunesCache) (fetchedSnapshot, error) {
+	chart, genre := store.SplitChartKey(chartKey)
+	if err := apple.CheckChart(chart); err != nil {
+		return fetchedSnapshot{}, err
 	}
 
-	rss, sourceURL, err := apple.FetchTopChart(ctx, client, country, chart, limit)
+	rss, sourceURL, err := client.FetchGenreChart(ctx, country, chart, genre, limit)
 	if err != nil {
-		return 0, 0, err
+		return fetchedSnapshot{}, err
 	}
 	if len(rss.Feed.Results) == 0 {
-		return 0, 0, fmt.Errorf("rss returned no results")
+		return fetchedSnapshot{}, fmt.Errorf("rss returned no results")
 	}
 
-	snapshotID, err := st.InsertSnapshot(store.Snapshot{
-		CollectedAt: time.Now().UTC(),
-		Country:     country,
-		Chart:       chart,
-		Limit:       limit,
-		SourceURL:   sourceURL,
-	})
+	themeConfig, themeContent, err := themes.themeConfig()
 	if err != nil {
-		return 0, 0, err
+		return fetchedSnapshot{}, err
 	}
 
+	collectedAt := time.Now().UTC()
+	items := make([]store.ChartItem, 0, len(rss.Feed.Results))
+	// firstRank remembers where each app was first seen. Results come in
+	// rank order, so a repeat is always the worse rank and is dropped rather
+	// than failing the insert on UNIQUE(snapshot_id, app_id).
+	firstRank := make(map[string]int, len(rss.Feed.Results))
 	for idx, item := range rss.Feed.Results {
 		rank := idx + 1
-		genres, genreIDs := apple.ExtractGenres(item.Genres)
-
-		var itunesMeta *apple.ItunesApp
-		if !noItunes {
-			meta, ok, err := apple.LookupApp(ctx, client, item.ID, country)
-			if err != nil {
-				log.Printf("itunes lookup failed for %s: %v", item.ID, err)
-			} else if ok {
-				itunesMeta = &meta
-			}
-			time.Sleep(150 * time.Millisecond)
+		if kept, ok := firstRank[item.ID]; ok {
+			slog.Warn("skipping duplicate app in feed", "app", item.Name, "app_id", item.ID, "rank", rank, "kept_rank", kept)
+			continue
 		}
-
-		chartItem := store.ChartItem{
-			SnapshotID:   snapshotID,
+		firstRank[item.ID] = rank
+		if themeConfig.IgnoresAt(analysis.IgnoreAtFetch) && themeConfig.IsIgnored(item.Name) {
+			slog.Info("ignoring app matching ignore_patterns", "app", item.Name, "app_id", item.ID, "rank", rank)
+			continue
+		}
+		genres, genreIDs := apple.ExtractGenres(item.Genres)
+		items = append(items, store.ChartItem{
 			Rank:         rank,
 			AppID:        item.ID,
 			AppName:      item.Name,
@@ -62,19 +88,233 @@ func fetchSnapshot(ctx context.Context, client *http.Client, st *store.Store, co
 			GenreIDs:     genreIDs,
 			PrimaryGenre: "",
 			ItunesGenres: nil,
+			ArtworkURL:   item.ArtworkURL,
+		})
+	}
+
+	feedUpdated, ok := rss.Feed.UpdatedTime()
+	if !ok && rss.Feed.Updated != "" {
+		slog.Warn("unrecognised feed updated time", "updated", rss.Feed.Updated)
+	}
+	if !force {
+		// Apple refreshes most feeds about once a day, so frequent polling
+		// mostly sees the chart it already has.
+		latest, duplicate, err := sameAsLatest(ctx, st, country, chartKey, feedUpdated, items)
+		if err != nil {
+			return fetchedSnapshot{}, err
+		}
+		if duplicate {
+			slog.Info("chart unchanged since latest snapshot, duplicate skipped", "country", country, "chart", chartKey, "snapshot_id", latest.ID)
+			return fetchedSnapshot{SnapshotID: latest.ID, Count: len(items), Duplicate: true}, nil
+		}
+	}
+
+	themeConfigID, err := st.SaveThemeConfigContext(ctx, themeContent)
+	if err != nil {
+		return fetchedSnapshot{}, err
+	}
+
+	if !noItunes {
+		metas := lookupItems(ctx, client, items, country, cache)
+		for i := range items {
+			if meta, ok := metas[items[i].AppID]; ok {
+				applyItunesMeta(&items[i], meta)
+			}
+		}
+	}
+
+	// Record the theme as classified now so later edits to the theme config
+	// don't rewrite history.
+	classifier := analysis.NewThemeClassifier(themeConfig)
+	for i := range items {
+		items[i].Theme = classifier.Classify(analysis.ItemThemeInput(items[i]))
+	}
+
+	snapshotID, err := st.InsertSnapshotWithItemsContext(ctx, store.Snapshot{
+		FeedUpdated:   feedUpdated,
+		CollectedAt:   collectedAt,
+		Country:       country,
+		Chart:         chart,
+		Genre:         genre,
+		Limit:         limit,
+		SourceURL:     sourceURL,
+		ThemeConfigID: themeConfigID,
+		ExpectedItems: store.NullableInt(len(items)),
+	}, items)
+	if err != nil {
+		return fetchedSnapshot{}, err
+	}
+
+	return fetchedSnapshot{SnapshotID: snapshotID, Count: len(items)}, nil
+}
+
+// sameAsLatest reports whether items, in rank order, and feedUpdated match
+// the latest stored snapshot of the chart, which it returns.
+func sameAsLatest(ctx context.Context, st *store.Store, country, chartKey string, feedUpdated time.Time, items []store.ChartItem) (store.Snapshot, bool, error) {
+	latest, err := st.GetLatestSnapshotContext(ctx, country, chartKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return latest, false, nil
+	}
+	if err != nil {
+		return latest, false, err
+	}
+	if !latest.FeedUpdated.Equal(feedUpdated) {
+		return latest, false, nil
+	}
+	stored, err := st.GetSnapshotItemsContext(ctx, latest.ID)
+	if err != nil {
+		return latest, false, err
+	}
+	if len(stored) != len(items) {
+		return latest, false, nil
+	}
+	for i := range items {
+		if stored[i].AppID != items[i].AppID {
+			return latest, false, nil
+		}
+	}
+	return latest, true, nil
+}
+
+// fetchAndEnrich fetches one chart for the fetch command, running the
+// deferred enrichment pass when asked, and returns a one-line summary.
+func fetchAndEnrich(ctx context.Context, client *apple.Client, st *store.Store, country, chart string, limit int, noItunes, deferEnrich, force bool, themes themeSource, cache *itunesCache) (string, error) {
+	fetched, err := fetchSnapshot(ctx, client, st, country, chart, limit, noItunes || deferEnrich, force, themes, cache)
+	if err != nil {
+		return "", err
+	}
+	snapshotID, count := fetched.SnapshotID, fetched.Count
+	if fetched.Duplicate {
+		return fmt.Sprintf("%s/%s: unchanged since snapshot %d, skipped", country, chart, snapshotID), nil
+	}
+	slog.Info("saved snapshot", "snapshot_id", snapshotID, "country", country, "chart", chart, "items", count)
+	summary := fmt.Sprintf("%s/%s: snapshot %d, %d items", country, chart, snapshotID, count)
+
+	if deferEnrich && !noItunes {
+		enriched, err := enrichSnapshot(ctx, client, st, snapshotID, country, cache)
+		if err != nil {
+			return "", err
 		}
+		slog.Info("enriched snapshot", "snapshot_id", snapshotID, "enriched", enriched, "items", count)
+		summary += fmt.Sprintf(", %d enriched", enriched)
+	}
+	return summary, nil
+}
 
-		if itunesMeta != nil {
-			chartItem.PrimaryGenre = itunesMeta.PrimaryGenreName
-			chartItem.ItunesGenres = itunesMeta.Genres
-			chartItem.RatingCount = store.NullableInt(itunesMeta.UserRatingCount)
-			chartItem.AverageRating = store.NullableFloat(itunesMeta.AverageUserRating)
+// enrichSnapshot runs iTunes lookups for a snapshot stored without them and
+// updates its rows in place, reclassifying each item with the theme config
+// the snapshot was collected under.
+func enrichSnapshot(ctx context.Context, client *apple.Client, st *store.Store, snapshotID int64, country string, cache *itunesCache) (int, error) {
+	snapshot, err := st.GetSnapshotByIDContext(ctx, snapshotID)
+	if err != nil {
+		return 0, err
+	}
+	items, err := st.GetSnapshotItemsContext(ctx, snapshotID)
+	if err != nil {
+		return 0, err
+	}
+	var classifier *analysis.ThemeClassifier
+	if snapshot.ThemeConfigID != 0 {
+		themeConfig, err := loadStoredThemeConfig(ctx, st, snapshot.ThemeConfigID)
+		if err != nil {
+			return 0, err
 		}
+		classifier = analysis.NewThemeClassifier(themeConfig)
+	}
 
-		if err := st.InsertChartItem(chartItem); err != nil {
-			return 0, 0, err
+	enriched := 0
+	metas := lookupItems(ctx, client, items, country, cache)
+	for _, item := range items {
+		meta, ok := metas[item.AppID]
+		if !ok {
+			continue
+		}
+		applyItunesMeta(&item, meta)
+		if classifier != nil {
+			item.Theme = classifier.Classify(analysis.ItemThemeInput(item))
 		}
+		if err := st.UpdateChartItemEnrichmentContext(ctx, item); err != nil {
+			return enriched, err
+		}
+		enriched++
 	}
+	return enriched, nil
+}
+
+// itunesCache remembers the lookups made during one run, including misses,
+// so an app charting in several lists of the same storefront is looked up
+// once. It is not safe for concurrent use.
+type itunesCache struct {
+	country string
+	apps    map[string]apple.ItunesApp
+	seen    map[string]bool
+}
+
+func newItunesCache(country string) *itunesCache {
+	return &itunesCache{
+		country: country,
+		apps:    map[string]apple.ItunesApp{},
+		seen:    map[string]bool{},
+	}
+}
+
+// lookupItems batch-looks up the items' iTunes metadata. Lookup failures are
+// logged and yield whatever was found, since enrichment is best-effort.
+// Items already looked up through cache are not requested again.
+func lookupItems(ctx context.Context, client *apple.Client, items []store.ChartItem, country string, cache *itunesCache) map[string]apple.ItunesApp {
+	if cache != nil && cache.country != country {
+		// Metadata is storefront-specific; never share it across countries.
+		cache = nil
+	}
+	found := map[string]apple.ItunesApp{}
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		if cache != nil && cache.seen[item.AppID] {
+			if meta, ok := cache.apps[item.AppID]; ok {
+				found[item.AppID] = meta
+			}
+			continue
+		}
+		ids = append(ids, item.AppID)
+	}
+	if len(ids) == 0 {
+		return found
+	}
+
+	// The client already retries 429 and 5xx responses; retrying the whole
+	// lookup on top of that would multiply the requests.
+	metas, err := client.LookupApps(ctx, ids, country)
+	if err != nil {
+		slog.Warn("itunes lookup failed", "err", err)
+	}
+	if err == nil && len(metas) < len(ids) {
+		// Delisted or region-locked apps are routine; this is not worth a
+		// warning on every collection.
+		var missing []string
+		for _, id := range ids {
+			if _, ok := metas[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		slog.Debug("itunes lookup: apps not found in storefront", "missing", missing, "apps", len(ids), "country", country)
+	}
+	for id, meta := range metas {
+		found[id] = meta
+	}
+	if cache != nil && err == nil {
+		for _, id := range ids {
+			cache.seen[id] = true
+			if meta, ok := metas[id]; ok {
+				cache.apps[id] = meta
+			}
+		}
+	}
+	return found
+}
 
-	return snapshotID, len(rss.Feed.Results), nil
+func applyItunesMeta(item *store.ChartItem, meta apple.ItunesApp) {
+	item.PrimaryGenre = meta.PrimaryGenreName
+	item.ItunesGenres = meta.Genres
+	item.RatingCount = store.NullableInt(meta.UserRatingCount)
+	item.AverageRating = store.NullableFloat(meta.AverageUserRating)
 }
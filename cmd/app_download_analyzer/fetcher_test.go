@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"app_download_analyzer/internal/apple"
+	"app_download_analyzer/internal/store"
+)
+
+func TestFetchSnapshotSkipsRepeatedApps(t *testing.T) {
+	// App 111 appears at ranks 1 and 3; the repeat must be dropped rather
+	// than failing the insert on UNIQUE(snapshot_id, app_id).
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"feed":{"results":[
+			{"id":"111","name":"Alpha"},
+			{"id":"222","name":"Beta"},
+			{"id":"111","name":"Alpha"},
+			{"id":"333","name":"Gamma"}
+		]}}`)
+	}))
+	defer srv.Close()
+	client := apple.NewClient(srv.Client())
+	client.RSSBaseURL = srv.URL
+
+	st, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer st.Close()
+
+	var logs bytes.Buffer
+	orig := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(orig)
+
+	themes := themeFile(filepath.Join(t.TempDir(), "missing.json"))
+	fetched, err := fetchSnapshot(context.Background(), client, st, "kr", "top-free", 4, true, true, themes, nil)
+	if err != nil {
+		t.Fatalf("fetchSnapshot: %v", err)
+	}
+	if fetched.Count != 3 {
+		t.Errorf("Count = %d, want 3", fetched.Count)
+	}
+
+	items, err := st.GetSnapshotItems(fetched.SnapshotID)
+	if err != nil {
+		t.Fatalf("GetSnapshotItems: %v", err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, fmt.Sprintf("%d:%s", item.Rank, item.AppID))
+	}
+	if want := "1:111 2:222 4:333"; strings.Join(got, " ") != want {
+		t.Errorf("stored ranks = %s, want %s", strings.Join(got, " "), want)
+	}
+	if !strings.Contains(logs.String(), `msg="skipping duplicate app in feed"`) || !strings.Contains(logs.String(), "kept_rank=1") {
+		t.Errorf("no duplicate warning logged:\n%s", logs.String())
+	}
+
+	// The dropped repeat is accounted for, so verify sees a whole snapshot.
+	snapshot, err := st.GetSnapshotByID(fetched.SnapshotID)
+	if err != nil {
+		t.Fatalf("GetSnapshotByID: %v", err)
+	}
+	if snapshot.ExpectedItems != store.NullableInt(3) {
+		t.Errorf("ExpectedItems = %+v, want 3", snapshot.ExpectedItems)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"app_download_analyzer/internal/analysis"
+	"app_download_analyzer/internal/store"
+)
+
+func runGainers(args []string) error {
+	fs := flag.NewFlagSet("gainers", flag.ExitOnError)
+	country := fs.String("country", defaultCountry, "storefront country code")
+	chart := fs.String("chart", defaultChart, chartUsage)
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	themePath := fs.String("themes", "config/themes.json", "theme rules json")
+	topN := fs.Int("top", 10, "top N gainers")
+	perDay := fs.Bool("per-day", false, "normalize review growth by days between snapshots")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	payload, err := computeReport(context.Background(), st, *country, *chart, themeFile(*themePath), analysis.TrendConfig{
+		RankWeight:   1.0,
+		ReviewWeight: 1.0,
+	}, reportOptions{})
+	if err != nil {
+		return err
+	}
+
+	days := payload.Latest.CollectedAt.Sub(payload.Previous.CollectedAt).Hours() / 24
+	if days <= 0 {
+		days = 1
+	}
+	growth := func(item analysis.AppTrend) float64 {
+		if *perDay {
+			return float64(*item.RatingDelta) / days
+		}
+		return float64(*item.RatingDelta)
+	}
+
+	var gainers []analysis.AppTrend
+	for _, item := range payload.Trends {
+		if item.RatingDelta != nil {
+			gainers = append(gainers, item)
+		}
+	}
+	sort.SliceStable(gainers, func(i, j int) bool {
+		return growth(gainers[i]) > growth(gainers[j])
+	})
+	if *topN > len(gainers) {
+		*topN = len(gainers)
+	}
+
+	fmt.Printf("Latest snapshot: %s (%s %s)\n", payload.Latest.CollectedAt.Format(time.RFC3339), payload.Latest.Country, payload.Latest.Chart)
+	fmt.Printf("Previous snapshot: %s\n", payload.Previous.CollectedAt.Format(time.RFC3339))
+	fmt.Println()
+
+	unit := ""
+	if *perDay {
+		unit = "/day"
+	}
+	fmt.Println("Top review gainers:")
+	for i := 0; i < *topN; i++ {
+		item := gainers[i]
+		// A rating delta implies a known rating count.
+		fmt.Printf("%2d. #%d %s (%s) reviews %+.0f%s total %d\n",
+			i+1, item.Rank, item.AppName, item.Theme, growth(item), unit, *item.RatingCount)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"app_download_analyzer/internal/store"
+)
+
+// unknownGenre counts apps stored without genre data, e.g. fetched with
+// --no-itunes.
+const unknownGenre = "unknown"
+
+type genresPayload struct {
+	Snapshot      reportSnapshot `json:"snapshot"`
+	Apps          int            `json:"apps"`
+	PrimaryGenres []genreCount   `json:"primary_genres"`
+	RSSGenres     []genreCount   `json:"rss_genres"`
+}
+
+type genreCount struct {
+	Genre string `json:"genre"`
+	Count int    `json:"count"`
+}
+
+// runGenres counts the latest snapshot's apps per raw App Store genre, with
+// no theme rules or scoring in between, to show which genres a market's
+// chart actually holds when tuning theme rules.
+func runGenres(args []string) error {
+	fs := flag.NewFlagSet("genres", flag.ExitOnError)
+	country := fs.String("country", defaultCountry, "storefront country code")
+	chart := fs.String("chart", defaultChart, chartUsage)
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	asJSON := fs.Bool("json", false, "emit the counts as JSON")
+	output := registerJSONFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	latest, err := st.GetLatestSnapshot(*country, *chart)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no snapshots for %s/%s; run fetch first", *country, *chart)
+	}
+	if err != nil {
+		return err
+	}
+	items, err := st.GetSnapshotItems(latest.ID)
+	if err != nil {
+		return err
+	}
+
+	primary := map[string]int{}
+	rss := map[string]int{}
+	for _, item := range items {
+		if item.PrimaryGenre != "" {
+			primary[item.PrimaryGenre]++
+		} else {
+			primary[unknownGenre]++
+		}
+		if len(item.Genres) == 0 {
+			rss[unknownGenre]++
+		}
+		// An app lists each of its RSS genres once, so it counts once per
+		// genre and the RSS counts can add up to more than the app count.
+		for _, genre := range item.Genres {
+			rss[genre]++
+		}
+	}
+	payload := genresPayload{
+		Snapshot:      newReportSnapshot(latest),
+		Apps:          len(items),
+		PrimaryGenres: sortedGenreCounts(primary),
+		RSSGenres:     sortedGenreCounts(rss),
+	}
+
+	if *asJSON {
+		return output.writeFile("-", payload)
+	}
+	fmt.Printf("Latest snapshot: %s (%s %s), %d apps\n", latest.CollectedAt.Format(time.RFC3339), latest.Country, latest.ChartKey(), len(items))
+	section := func(title string, counts []genreCount) {
+		fmt.Println()
+		fmt.Printf("%s:\n", title)
+		for _, entry := range counts {
+			fmt.Printf("%4d  %s\n", entry.Count, entry.Genre)
+		}
+	}
+	section("Primary genre (iTunes)", payload.PrimaryGenres)
+	section("RSS genres", payload.RSSGenres)
+	return nil
+}
+
+// sortedGenreCounts orders counts from most to least common, by name on ties.
+func sortedGenreCounts(counts map[string]int) []genreCount {
+	entries := make([]genreCount, 0, len(counts))
+	for genre, count := range counts {
+		entries = append(entries, genreCount{Genre: genre, Count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Genre < entries[j].Genre
+	})
+	return entries
+}
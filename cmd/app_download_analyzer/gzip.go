@@ -0,0 +1,78 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// gzipHandler compresses next's response when the client accepts gzip. The
+// compressor only flushes when next returns, so streaming handlers such as
+// /api/events must not be wrapped.
+func gzipHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, gz: gzip.NewWriter(w)}
+		defer gw.close()
+		next(gw, r)
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter routes the body through gz. Any Content-Length set by
+// the handler describes the uncompressed body, so it is dropped.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+	// bodyless is set for a 304, which must carry neither a body nor gzip
+	// framing.
+	bodyless bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if status == http.StatusNotModified {
+		w.bodyless = true
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", "gzip")
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.gz.Write(p)
+}
+
+// close flushes the compressed body. A handler that never wrote anything,
+// or answered 304, gets no gzip framing either.
+func (w *gzipResponseWriter) close() {
+	if w.wroteHeader && !w.bodyless {
+		_ = w.gz.Close()
+	}
+}
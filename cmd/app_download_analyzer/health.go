@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"app_download_analyzer/internal/store"
+)
+
+// fetchTracker remembers when the last fetch started, when the last one
+// succeeded, and the error of the last one if it failed. It has its own
+// lock so probes never wait on the report mutex while a fetch is running.
+type fetchTracker struct {
+	mu      sync.Mutex
+	started time.Time
+	last    time.Time
+	lastErr error
+}
+
+func (t *fetchTracker) begin(at time.Time) {
+	t.mu.Lock()
+	t.started = at
+	t.mu.Unlock()
+}
+
+// beginUnlessWithin records a fetch starting at at, unless another started
+// less than gap earlier; then it returns false and how long to wait.
+func (t *fetchTracker) beginUnlessWithin(at time.Time, gap time.Duration) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.started.IsZero() {
+		if wait := t.started.Add(gap).Sub(at); wait > 0 {
+			return wait, false
+		}
+	}
+	t.started = at
+	return 0, true
+}
+
+func (t *fetchTracker) record(at time.Time) {
+	t.mu.Lock()
+	t.last = at
+	t.lastErr = nil
+	t.mu.Unlock()
+}
+
+// fail records that the latest fetch gave up with err.
+func (t *fetchTracker) fail(err error) {
+	t.mu.Lock()
+	t.lastErr = err
+	t.mu.Unlock()
+}
+
+// lastError returns the error of the latest fetch, or nil if it succeeded.
+func (t *fetchTracker) lastError() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastErr
+}
+
+func (t *fetchTracker) lastSuccess() *time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.last.IsZero() {
+		return nil
+	}
+	last := t.last
+	return &last
+}
+
+// readyzPayload is the /readyz response body.
+type readyzPayload struct {
+	Ready         bool       `json:"ready"`
+	Country       string     `json:"country"`
+	Chart         string     `json:"chart"`
+	Snapshots     int        `json:"snapshots"`
+	LastAutoFetch *time.Time `json:"last_auto_fetch"`
+	// LastFetchError is why the latest fetch failed; it clears once one
+	// succeeds. A failed fetch alone doesn't make the server unready.
+	LastFetchError string `json:"last_fetch_error,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// registerHealthHandlers adds the /healthz liveness and /readyz readiness
+// probes. Readiness only needs a count query, which the database handles
+// concurrently, so neither probe takes the report mutex.
+func registerHealthHandlers(st *store.Store, country, chart string, fetches *fetchTracker, output jsonOutput) {
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write([]byte("ok\n"))
+	})
+
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		payload := readyzPayload{
+			Country:       country,
+			Chart:         chart,
+			LastAutoFetch: fetches.lastSuccess(),
+		}
+		if err := fetches.lastError(); err != nil {
+			payload.LastFetchError = err.Error()
+		}
+		count, err := st.CountSnapshotsContext(r.Context(), country, chart)
+		if err != nil {
+			payload.Error = err.Error()
+		}
+		payload.Snapshots = count
+		payload.Ready = err == nil && count > 0
+
+		status := http.StatusOK
+		if !payload.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		output.serveStatus(w, status, payload)
+	})
+}
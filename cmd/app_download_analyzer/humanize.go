@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// countUnits are the abbreviations humanizeCount steps through, smallest
+// first.
+var countUnits = []string{"K", "M", "B"}
+
+// humanizeCount abbreviates large counts for display, e.g. 1234567 -> "1.2M".
+// A value that rounds up to 1000 of one unit is shown in the next, so
+// 999950 is "1M" rather than "1000K".
+func humanizeCount(value int) string {
+	if value > -1000 && value < 1000 {
+		return strconv.Itoa(value)
+	}
+	sign := ""
+	n := float64(value)
+	if value < 0 {
+		sign = "-"
+		n = -n
+	}
+	for i, unit := range countUnits {
+		n /= 1000
+		rounded := math.Round(n*10) / 10
+		if rounded < 1000 || i == len(countUnits)-1 {
+			return sign + trimDecimal(rounded) + unit
+		}
+	}
+	return strconv.Itoa(value)
+}
+
+func trimDecimal(value float64) string {
+	out := strconv.FormatFloat(value, 'f', 1, 64)
+	return strings.TrimSuffix(out, ".0")
+}
+
+func humanizeReport(payload *reportPayload) {
+	for i := range payload.Trends {
+		if count := payload.Trends[i].RatingCount; count != nil {
+			payload.Trends[i].RatingCountDisplay = humanizeCount(*count)
+		}
+	}
+}
+
+func humanizeTimeSeries(payload *timeSeriesPayload) {
+	for i := range payload.TopApps {
+		app := &payload.TopApps[i]
+		app.RatingCountsDisplay = make([]*string, len(app.RatingCounts))
+		for idx, count := range app.RatingCounts {
+			if count == nil {
+				continue
+			}
+			display := humanizeCount(*count)
+			app.RatingCountsDisplay[idx] = &display
+		}
+	}
+}
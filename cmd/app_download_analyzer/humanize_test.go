@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestHumanizeCount(t *testing.T) {
+	tests := []struct {
+		value int
+		want  string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{-999, "-999"},
+		{1000, "1K"},
+		{1234, "1.2K"},
+		{999_949, "999.9K"},
+		{999_950, "1M"},
+		{999_999, "1M"},
+		{-999_999, "-1M"},
+		{1_234_567, "1.2M"},
+		{999_949_999, "999.9M"},
+		{999_950_000, "1B"},
+		{2_500_000_000, "2.5B"},
+		{1_500_000_000_000, "1500B"},
+	}
+	for _, tt := range tests {
+		if got := humanizeCount(tt.value); got != tt.want {
+			t.Errorf("humanizeCount(%d) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
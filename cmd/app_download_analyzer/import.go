@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"app_download_analyzer/internal/store"
+)
+
+// runImport rebuilds snapshots from a CSV written by export, e.g. to move a
+// store to another host.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	inPath := fs.String("in", "-", "input CSV path or '-' for stdin")
+	overwrite := fs.Bool("overwrite", false, "replace snapshots already in the db instead of skipping them")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if *inPath != "-" {
+		file, err := os.Open(*inPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	snapshots, err := readExportCSV(in)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *inPath, err)
+	}
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	result, err := st.ImportSnapshots(snapshots, *overwrite)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %d snapshots (%d new, %d replaced, %d skipped as already stored)\n",
+		len(snapshots), result.Inserted, result.Replaced, result.Skipped)
+	return nil
+}
+
+// readExportCSV parses export's CSV back into snapshots, one per distinct
+// collected_at, country and chart, in file order. Fields export leaves out,
+// such as artist and genres, stay empty.
+func readExportCSV(in io.Reader) ([]store.ImportedSnapshot, error) {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("empty CSV, expected header %s", strings.Join(exportHeader, ","))
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Spreadsheets often save CSV with a byte order mark.
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	if len(header) != len(exportHeader) {
+		return nil, fmt.Errorf("header has %d columns, expected %d: %s",
+			len(header), len(exportHeader), strings.Join(exportHeader, ","))
+	}
+	for i, column := range exportHeader {
+		if header[i] != column {
+			return nil, fmt.Errorf("column %d is %q, expected %q (header must be %s)",
+				i+1, header[i], column, strings.Join(exportHeader, ","))
+		}
+	}
+	r.FieldsPerRecord = len(exportHeader)
+
+	var snapshots []store.ImportedSnapshot
+	index := map[string]int{}
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		snapshot, item, err := parseExportRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		key := snapshot.CollectedAt.Format(time.RFC3339) + "|" + record[1] + "|" + record[2]
+		i, ok := index[key]
+		if !ok {
+			i = len(snapshots)
+			index[key] = i
+			snapshots = append(snapshots, store.ImportedSnapshot{Snapshot: snapshot})
+		}
+		snapshots[i].Items = append(snapshots[i].Items, item)
+	}
+	for i := range snapshots {
+		snapshots[i].Limit = len(snapshots[i].Items)
+		snapshots[i].ExpectedItems = store.NullableInt(len(snapshots[i].Items))
+	}
+	return snapshots, nil
+}
+
+func parseExportRecord(record []string) (store.Snapshot, store.ChartItem, error) {
+	collectedAt, err := time.Parse(time.RFC3339, record[0])
+	if err != nil {
+		return store.Snapshot{}, store.ChartItem{}, fmt.Errorf("invalid collected_at %q", record[0])
+	}
+	if record[1] == "" || record[2] == "" {
+		return store.Snapshot{}, store.ChartItem{}, fmt.Errorf("country and chart are required")
+	}
+	chart, genre := store.SplitChartKey(record[2])
+	// Rows written with an offset name the same instant as export's UTC
+	// form; store and group them in UTC so they match existing snapshots.
+	snapshot := store.Snapshot{
+		CollectedAt: collectedAt.UTC(),
+		Country:     record[1],
+		Chart:       chart,
+		Genre:       genre,
+	}
+
+	rank, err := strconv.Atoi(record[3])
+	if err != nil || rank < 1 {
+		return store.Snapshot{}, store.ChartItem{}, fmt.Errorf("invalid rank %q", record[3])
+	}
+	if record[4] == "" {
+		return store.Snapshot{}, store.ChartItem{}, fmt.Errorf("app_id is required")
+	}
+	item := store.ChartItem{
+		Rank:    rank,
+		AppID:   record[4],
+		AppName: record[5],
+		Theme:   record[6],
+	}
+	if record[7] != "" {
+		count, err := strconv.Atoi(record[7])
+		if err != nil {
+			return store.Snapshot{}, store.ChartItem{}, fmt.Errorf("invalid rating_count %q", record[7])
+		}
+		item.RatingCount = store.NullableInt(count)
+	}
+	if record[8] != "" {
+		average, err := strconv.ParseFloat(record[8], 64)
+		if err != nil {
+			return store.Snapshot{}, store.ChartItem{}, fmt.Errorf("invalid average_rating %q", record[8])
+		}
+		item.AverageRating = store.NullableFloat(average)
+	}
+	return snapshot, item, nil
+}
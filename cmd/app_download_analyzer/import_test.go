@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadExportCSVNormalisesOffsets(t *testing.T) {
+	csv := strings.Join([]string{
+		strings.Join(exportHeader, ","),
+		"2024-01-15T09:00:00+09:00,kr,top-free,1,111,Alpha,games,10,4.5",
+		"2024-01-15T00:00:00Z,kr,top-free,2,222,Beta,finance,,",
+	}, "\n")
+	snapshots, err := readExportCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("readExportCSV: %v", err)
+	}
+	if len(snapshots) != 1 {
+		t.Fatalf("got %d snapshots, want the two rows grouped into one", len(snapshots))
+	}
+	want := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	if got := snapshots[0].CollectedAt; !got.Equal(want) || got.Location() != time.UTC {
+		t.Errorf("collected_at = %s, want %s", got, want)
+	}
+	if len(snapshots[0].Items) != 2 {
+		t.Errorf("got %d items, want 2", len(snapshots[0].Items))
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// jsonOutput is the single place JSON payloads are formatted, shared by the
+// CLI exports and the HTTP API.
+type jsonOutput struct {
+	// Indent is the per-level indent; ignored when Compact is set.
+	Indent  string
+	Compact bool
+	// Precision rounds floating-point numbers to this many decimal places;
+	// negative leaves them untouched.
+	Precision int
+}
+
+var defaultJSONOutput = jsonOutput{Indent: "  ", Precision: -1}
+
+// registerJSONFlags adds --compact and --precision to a command's flag set.
+func registerJSONFlags(fs *flag.FlagSet) *jsonOutput {
+	out := defaultJSONOutput
+	fs.BoolVar(&out.Compact, "compact", false, "emit compact JSON without indentation")
+	fs.IntVar(&out.Precision, "precision", -1, "round floats to N decimal places (-1 keeps full precision)")
+	return &out
+}
+
+func (o jsonOutput) marshal(payload any) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	if o.Precision >= 0 {
+		data, err = roundJSONNumbers(data, o.Precision)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !o.Compact && o.Indent != "" {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, data, "", o.Indent); err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
+	}
+	return append(data, '\n'), nil
+}
+
+func (o jsonOutput) encode(w io.Writer, payload any) error {
+	data, err := o.marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode json: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// writeFile writes payload to path, or stdout when path is "-".
+func (o jsonOutput) writeFile(path string, payload any) error {
+	if path == "-" {
+		return o.encode(os.Stdout, payload)
+	}
+	if err := ensureDirForFile(path); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return o.encode(file, payload)
+}
+
+// serve writes payload as a JSON API response, uncached unless the handler
+// has already set Cache-Control.
+func (o jsonOutput) serve(w http.ResponseWriter, payload any) {
+	o.serveStatus(w, http.StatusOK, payload)
+}
+
+// serveStatus is serve with an explicit response status.
+func (o jsonOutput) serveStatus(w http.ResponseWriter, status int, payload any) {
+	data, err := o.marshal(payload)
+	if err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// roundJSONNumbers re-emits compact JSON with every non-integer number
+// rounded to precision decimals, preserving key order.
+func roundJSONNumbers(data []byte, precision int) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	// Each open container tracks whether the next token is its first
+	// element and, for objects, whether it is a key.
+	type frame struct {
+		object bool
+		count  int
+	}
+	var stack []frame
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if delim, ok := tok.(json.Delim); ok && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			buf.WriteByte(byte(delim))
+			continue
+		}
+		if n := len(stack); n > 0 {
+			top := &stack[n-1]
+			if top.count > 0 {
+				if top.object && top.count%2 == 1 {
+					buf.WriteByte(':')
+				} else {
+					buf.WriteByte(',')
+				}
+			}
+			top.count++
+		}
+		switch value := tok.(type) {
+		case json.Delim:
+			buf.WriteByte(byte(value))
+			stack = append(stack, frame{object: value == '{'})
+		case json.Number:
+			buf.WriteString(roundNumber(value, precision))
+		default:
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(encoded)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func roundNumber(value json.Number, precision int) string {
+	raw := value.String()
+	if !strings.ContainsAny(raw, ".eE") {
+		return raw
+	}
+	f, err := value.Float64()
+	if err != nil {
+		return raw
+	}
+	scale := math.Pow(10, float64(precision))
+	return strconv.FormatFloat(math.Round(f*scale)/scale, 'f', -1, 64)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"app_download_analyzer/internal/store"
+)
+
+type snapshotListEntry struct {
+	ID          int64      `json:"id"`
+	CollectedAt time.Time  `json:"collected_at"`
+	FeedUpdated *time.Time `json:"feed_updated,omitempty"`
+	Country     string     `json:"country"`
+	Chart       string     `json:"chart"`
+	Genre       string     `json:"genre,omitempty"`
+	Limit       int        `json:"limit"`
+	ItemCount   int        `json:"item_count"`
+	Tag         string     `json:"tag,omitempty"`
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	country := fs.String("country", "", "storefront country code (empty for all)")
+	chart := fs.String("chart", "", "chart name (empty for all)")
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	limit := fs.Int("limit", 0, "show only the most recent N snapshots (0 for all)")
+	tag := fs.String("tag", "", "only list snapshots with this tag (see the tag command)")
+	asJSON := fs.Bool("json", false, "emit the list as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	var summaries []store.SnapshotSummary
+	if *tag != "" {
+		summaries, err = st.ListSnapshotsByTag(*country, *chart, *tag)
+		if *limit > 0 && len(summaries) > *limit {
+			summaries = summaries[:*limit]
+		}
+	} else {
+		summaries, err = st.ListSnapshotSummaries(*country, *chart, *limit)
+	}
+	if err != nil {
+		return err
+	}
+
+	entries := snapshotListEntries(summaries)
+
+	if *asJSON {
+		return defaultJSONOutput.writeFile("-", entries)
+	}
+
+	fmt.Printf("%-6s %-25s %-25s %-8s %-14s %6s %6s  %s\n", "ID", "COLLECTED_AT", "FEED_UPDATED", "COUNTRY", "CHART", "LIMIT", "ITEMS", "TAG")
+	for _, entry := range entries {
+		updated := "-"
+		if entry.FeedUpdated != nil {
+			updated = entry.FeedUpdated.Format(time.RFC3339)
+		}
+		line := fmt.Sprintf("%-6d %-25s %-25s %-8s %-14s %6d %6d  %s",
+			entry.ID, entry.CollectedAt.Format(time.RFC3339), updated, entry.Country, store.ChartKey(entry.Chart, entry.Genre), entry.Limit, entry.ItemCount, entry.Tag)
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	return nil
+}
+
+func snapshotListEntries(summaries []store.SnapshotSummary) []snapshotListEntry {
+	entries := make([]snapshotListEntry, 0, len(summaries))
+	for _, summary := range summaries {
+		var feedUpdated *time.Time
+		if !summary.FeedUpdated.IsZero() {
+			updated := summary.FeedUpdated
+			feedUpdated = &updated
+		}
+		entries = append(entries, snapshotListEntry{
+			ID:          summary.ID,
+			CollectedAt: summary.CollectedAt,
+			FeedUpdated: feedUpdated,
+			Country:     summary.Country,
+			Chart:       summary.Chart,
+			Genre:       summary.Genre,
+			Limit:       summary.Limit,
+			ItemCount:   summary.ItemCount,
+			Tag:         summary.Tag,
+		})
+	}
+	return entries
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logFlags holds the --log-level and --log-format flags parseFlags adds to
+// every command.
+type logFlags struct {
+	level  string
+	format string
+}
+
+func registerLogFlags(fs *flag.FlagSet) *logFlags {
+	flags := &logFlags{}
+	fs.StringVar(&flags.level, "log-level", "info", "minimum log level (debug, info, warn, error)")
+	fs.StringVar(&flags.format, "log-format", logFormatText, "log output format (text, json)")
+	return flags
+}
+
+// apply installs the default slog logger, writing to stderr so it never
+// mixes with a command's output on stdout.
+func (f *logFlags) apply() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(f.level)); err != nil {
+		return fmt.Errorf("unsupported log level: %s", f.level)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch f.format {
+	case logFormatText:
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case logFormatJSON:
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unsupported log format: %s", f.format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
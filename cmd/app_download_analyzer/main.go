@@ -4,14 +4,15 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
+	"math"
 	"os"
-	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"app_download_analyzer/internal/analysis"
+	"app_download_analyzer/internal/apple"
 	"app_download_analyzer/internal/store"
 )
 
@@ -20,64 +21,126 @@ const (
 	defaultChart   = "top-free"
 	defaultLimit   = 25
 	defaultDBPath  = "data/appstore.db"
+
+	chartUsage = "chart name (top-free, top-paid, top-grossing, new-apps-we-love, new-games-we-love)"
 )
 
 func main() {
-	log.SetFlags(0)
 	if len(os.Args) < 2 {
 		printUsage()
 		return
 	}
 
-	switch os.Args[1] {
-	case "fetch":
-		if err := runFetch(os.Args[2:]); err != nil {
-			log.Fatal(err)
-		}
-	case "report":
-		if err := runReport(os.Args[2:]); err != nil {
-			log.Fatal(err)
-		}
-	case "report-json":
-		if err := runReportJSON(os.Args[2:]); err != nil {
-			log.Fatal(err)
-		}
-	case "timeseries-json":
-		if err := runTimeSeriesJSON(os.Args[2:]); err != nil {
-			log.Fatal(err)
-		}
-	case "serve":
-		if err := runServe(os.Args[2:]); err != nil {
-			log.Fatal(err)
-		}
-	default:
+	run, ok := commands()[os.Args[1]]
+	if !ok {
 		printUsage()
+		return
+	}
+	if err := run(os.Args[2:]); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// commands maps each command name to the function running it. It is a
+// function rather than a variable because the commands' flag parsing
+// consults it for --config sections.
+func commands() map[string]func(args []string) error {
+	return map[string]func(args []string) error{
+		"fetch":              runFetch,
+		"list":               runList,
+		"prune":              runPrune,
+		"verify":             runVerify,
+		"tag":                runTag,
+		"backfill":           runBackfill,
+		"report":             runReport,
+		"top-apps":           runTopApps,
+		"genres":             runGenres,
+		"compare":            runCompare,
+		"diff":               runDiff,
+		"export":             runExport,
+		"import":             runImport,
+		"report-json":        runReportJSON,
+		"timeseries-json":    runTimeSeriesJSON,
+		"divergence":         runDivergence,
+		"composite-rotation": runCompositeRotation,
+		"gainers":            runGainers,
+		"stability":          runStability,
+		"validate-themes":    runValidateThemes,
+		"schema":             runSchema,
+		"serve":              runServe,
 	}
 }
 
 func printUsage() {
 	fmt.Println("Usage:")
-	fmt.Println("  app_download_analyzer fetch [--country kr] [--chart top-free] [--limit 25] [--db data/appstore.db] [--no-itunes]")
-	fmt.Println("  app_download_analyzer report [--country kr] [--chart top-free] [--db data/appstore.db] [--top 10] [--themes config/themes.json]")
-	fmt.Println("  app_download_analyzer report-json [--country kr] [--chart top-free] [--db data/appstore.db] [--themes config/themes.json] [--out report.json]")
-	fmt.Println("  app_download_analyzer timeseries-json [--country kr] [--chart top-free] [--db data/appstore.db] [--themes config/themes.json] [--out timeseries.json] [--top 10]")
-	fmt.Println("  app_download_analyzer serve [--country kr] [--chart top-free] [--limit 25] [--db data/appstore.db] [--themes config/themes.json] [--addr :8080]")
-	fmt.Println("    (optional) --auto-fetch --fetch-on-start --interval 6h --no-itunes")
+	fmt.Println("  app_download_analyzer fetch [--country kr[,us,...]] [--chart top-free[,top-paid,...]] [--limit 25] [--db data/appstore.db] [--themes config/themes.json] [--no-itunes] [--defer-enrich] [--genre 6014] [--force] [--min-interval 20h] [--itunes-lang en_us]")
+	fmt.Println("  app_download_analyzer list [--country kr] [--chart top-free] [--db data/appstore.db] [--limit 20] [--tag baseline] [--json]")
+	fmt.Println("  app_download_analyzer prune [--country kr] [--chart top-free] [--db data/appstore.db] [--older-than 30d] [--keep-last N] [--dry-run]")
+	fmt.Println("  app_download_analyzer verify [--country kr] [--chart top-free] [--db data/appstore.db] [--fix [--yes]]")
+	fmt.Println("  app_download_analyzer tag --id 42 (--set baseline | --clear) [--db data/appstore.db]")
+	fmt.Println("  app_download_analyzer backfill [--country kr] [--chart top-free] [--db data/appstore.db] [--themes config/themes.json] [--dry-run]")
+	fmt.Println("  app_download_analyzer report [--country kr] [--chart top-free] [--db data/appstore.db] [--top 10] [--themes config/themes.json] [--as-of 2024-02-01] [--tz ZONE] [--granularity theme|genre] [--compare-to-yesterday] [--sticky 10] [--launch-days 30] [--group-by-theme] [--format table|markdown|tsv] [--normalize-per-day] [--weighted-themes] [--score-method zscore|percentile] [--reclassify] [--genre 6014]")
+	fmt.Println("  app_download_analyzer top-apps [--country kr] [--chart top-free] [--db data/appstore.db] [--top 25] [--themes config/themes.json] [--reclassify] [--json]")
+	fmt.Println("  app_download_analyzer genres [--country kr] [--chart top-free] [--db data/appstore.db] [--json]")
+	fmt.Println("  app_download_analyzer compare --from ID --to ID [--db data/appstore.db] [--top 10] [--themes config/themes.json] [--granularity theme|genre] [--group-by-theme] [--format table|markdown|tsv] [--json] [--diff]")
+	fmt.Println("  app_download_analyzer diff --date 2024-02-01 [--tz ZONE] [--country kr] [--chart top-free] [--db data/appstore.db] [--top 10] [--json]")
+	fmt.Println("  app_download_analyzer export [--country kr] [--chart top-free] [--db data/appstore.db] [--themes config/themes.json] [--since 2024-01-01] [--until 2024-01-31] [--tz ZONE] [--out items.csv]")
+	fmt.Println("  app_download_analyzer import [--db data/appstore.db] [--in items.csv] [--overwrite]")
+	fmt.Println("  app_download_analyzer report-json [--country kr] [--chart top-free] [--db data/appstore.db] [--themes config/themes.json] [--out report.json] [--humanize-counts] [--as-of 2024-02-01] [--tz ZONE]")
+	fmt.Println("  app_download_analyzer timeseries-json [--country kr] [--chart top-free] [--db data/appstore.db] [--themes config/themes.json] [--out timeseries.json] [--top 10] [--humanize-counts] [--ewma-alpha 0.3] [--since 2024-01-01] [--until 2024-03-01] [--rotation-threshold 0.5] [--ma-short 3] [--ma-long 7] [--granularity raw|day|week|month] [--tz ZONE]")
+	fmt.Println("  app_download_analyzer divergence [--country kr] [--chart top-free] [--db data/appstore.db] [--themes config/themes.json] [--threshold 1.0]")
+	fmt.Println("  app_download_analyzer composite-rotation [--country kr] [--charts top-free,top-paid,top-grossing] [--weights top-free=1,top-paid=1,top-grossing=2] [--db data/appstore.db]")
+	fmt.Println("  app_download_analyzer gainers [--country kr] [--chart top-free] [--db data/appstore.db] [--top 10] [--per-day]")
+	fmt.Println("  app_download_analyzer stability [--country kr] [--chart top-free] [--db data/appstore.db] [--last 10]")
+	fmt.Println("  app_download_analyzer validate-themes [--themes config/themes.json]")
+	fmt.Println("  app_download_analyzer schema [--payload report|timeseries] [--compact]")
+	fmt.Println("  app_download_analyzer serve [--country kr] [--chart top-free] [--limit 25] [--db data/appstore.db] [--themes config/themes.json] [--themes-poll 5s] [--addr :8080] [--read-timeout 15s] [--write-timeout 30s] [--report-max-age 1m] [--no-store] [--compact] [--precision 4]")
+	fmt.Println("    (optional) --auto-fetch --fetch-on-start --interval 6h --no-itunes --defer-enrich")
+	fmt.Println("Every command also accepts --config file.json to read flag defaults from a file.")
 }
 
 func runFetch(args []string) error {
 	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
-	country := fs.String("country", defaultCountry, "storefront country code")
-	chart := fs.String("chart", defaultChart, "chart name (top-free, top-paid)")
+	country := fs.String("country", defaultCountry, "storefront country code; comma-separate to fetch several")
+	chart := fs.String("chart", defaultChart, chartUsage+"; comma-separate to fetch several")
 	limit := fs.Int("limit", defaultLimit, "chart size (25 or 50 recommended)")
 	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
 	noItunes := fs.Bool("no-itunes", false, "skip iTunes lookup enrichment")
 	timeout := fs.Duration("timeout", 20*time.Second, "http timeout")
-	if err := fs.Parse(args); err != nil {
+	themePath := fs.String("themes", "config/themes.json", "theme rules json recorded with the snapshot")
+	deferEnrich := fs.Bool("defer-enrich", false, "store the chart first, then run iTunes enrichment as a second pass")
+	force := fs.Bool("force", false, "store the chart even when it matches the latest snapshot")
+	minInterval := fs.Duration("min-interval", 0, "skip a chart already collected within this long of now (0 fetches every time)")
+	genre := fs.String("genre", "", "only fetch apps in this genre id (e.g. 6014 for games)")
+	itunesConcurrency := fs.Int("itunes-concurrency", 4, "iTunes lookup requests, and storefronts, to fetch at once")
+	itunesRate := fs.Int("itunes-rate", apple.DefaultLookupsPerMinute, "max iTunes lookup requests per minute (0 for no limit)")
+	itunesDelay := fs.Duration("itunes-delay", 150*time.Millisecond, "pause between iTunes lookup requests of one chart")
+	itunesLang := fs.String("itunes-lang", "", "language for iTunes lookup results, e.g. en_us (empty for the storefront default)")
+	if err := parseFlags(fs, args); err != nil {
 		return err
 	}
 
-	client := &http.Client{Timeout: *timeout}
+	countries := splitCSV(strings.ToLower(*country))
+	if len(countries) == 0 {
+		return fmt.Errorf("--country is required")
+	}
+	charts := splitCSV(*chart)
+	if len(charts) == 0 {
+		return fmt.Errorf("--chart is required")
+	}
+	for i, name := range charts {
+		if err := apple.CheckChart(name); err != nil {
+			return err
+		}
+		key, err := chartKeyArg(name, *genre)
+		if err != nil {
+			return err
+		}
+		charts[i] = key
+	}
+
+	client := newAppleClient(*timeout, *itunesConcurrency, *itunesRate, *itunesDelay, *itunesLang)
 	ctx := context.Background()
 
 	st, err := store.Open(*dbPath)
@@ -86,28 +149,150 @@ func runFetch(args []string) error {
 	}
 	defer st.Close()
 
-	snapshotID, count, err := fetchSnapshot(ctx, client, st, *country, *chart, *limit, *noItunes)
-	if err != nil {
-		return err
+	// fetchCountry fetches every chart of one storefront in order; its
+	// iTunes metadata is localized, so each storefront gets its own cache.
+	type countryResult struct {
+		summaries []string
+		failed    int
+		lastErr   error
+	}
+	fetchCountry := func(cc string) countryResult {
+		var result countryResult
+		cache := newItunesCache(cc)
+		for _, name := range charts {
+			var summary string
+			var err error
+			if *minInterval > 0 {
+				var recent bool
+				var id int64
+				recent, id, err = st.SnapshotExistsWithinContext(ctx, cc, name, time.Now(), *minInterval)
+				if err == nil && recent {
+					slog.Info("chart collected recently, fetch skipped", "country", cc, "chart", name, "snapshot_id", id)
+					result.summaries = append(result.summaries, fmt.Sprintf("%s/%s: snapshot %d is within --min-interval, skipped", cc, name, id))
+					continue
+				}
+			}
+			if err == nil {
+				summary, err = fetchAndEnrich(ctx, client, st, cc, name, *limit, *noItunes, *deferEnrich, *force, themeFile(*themePath), cache)
+			}
+			if err != nil {
+				slog.Error("fetch failed", "country", cc, "chart", name, "err", err)
+				summary = fmt.Sprintf("%s/%s: failed: %v", cc, name, err)
+				result.failed++
+				result.lastErr = err
+			}
+			result.summaries = append(result.summaries, summary)
+		}
+		return result
 	}
 
-	log.Printf("saved snapshot %d (%s/%s, %d items)", snapshotID, *country, *chart, count)
-	return nil
+	// Up to --itunes-concurrency storefronts are fetched at once. A single
+	// chart rarely needs more than one lookup request, so this is where
+	// the workers pay off; the rate limiter still bounds the total.
+	workers := *itunesConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]countryResult, len(countries))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(countries); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j] = fetchCountry(countries[j])
+			}
+		}()
+	}
+	for i := range countries {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var summaries []string
+	var failed int
+	var lastErr error
+	for _, result := range results {
+		summaries = append(summaries, result.summaries...)
+		failed += result.failed
+		if result.lastErr != nil {
+			lastErr = result.lastErr
+		}
+	}
+
+	total := len(countries) * len(charts)
+	if total > 1 {
+		for _, summary := range summaries {
+			fmt.Println(summary)
+		}
+	}
+	switch {
+	case failed == 0:
+		return nil
+	case total == 1:
+		return lastErr
+	default:
+		return fmt.Errorf("%d of %d fetches failed", failed, total)
+	}
 }
 
 func runReport(args []string) error {
 	fs := flag.NewFlagSet("report", flag.ExitOnError)
 	country := fs.String("country", defaultCountry, "storefront country code")
-	chart := fs.String("chart", defaultChart, "chart name (top-free, top-paid)")
+	chart := fs.String("chart", defaultChart, chartUsage)
 	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
 	topN := fs.Int("top", 10, "top N trending apps")
 	themePath := fs.String("themes", "config/themes.json", "theme rules json")
 	rankWeight := fs.Float64("rank-weight", 1.0, "weight for rank delta z-score")
 	reviewWeight := fs.Float64("review-weight", 1.0, "weight for review growth z-score")
 	newEntryBonus := fs.Float64("new-bonus", 0.5, "bonus for new chart entries")
-	if err := fs.Parse(args); err != nil {
+	ratingAvgWeight := fs.Float64("rating-avg-weight", 0, "weight for average rating delta (0 leaves it out of the score)")
+	launchDays := fs.Int("launch-days", 30, "flag apps released within this many days of the snapshot as launches")
+	normalizePerDay := fs.Bool("normalize-per-day", false, "add each app's rating growth per day between snapshots (display only)")
+	weightedThemes := fs.Bool("weighted-themes", false, "spread apps across all matching themes when scoring momentum")
+	scoreMethodFlag := fs.String("score-method", analysis.ScoreZScore, "delta scoring (zscore, percentile)")
+	reclassify := fs.Bool("reclassify", false, "classify apps with the current theme config instead of the stored themes")
+	genre := fs.String("genre", "", "report on the chart fetched with this --genre id")
+	granularity := fs.String("granularity", "theme", "momentum grouping (theme, genre)")
+	historyDays := fs.Int("history-days", 90, "days of history used to rank the rotation index (0 disables)")
+	groupByTheme := fs.Bool("group-by-theme", false, "group trending apps by theme, themes ordered by momentum")
+	compareToYesterday := fs.Bool("compare-to-yesterday", false, "compare against the snapshot closest to 24h before the latest")
+	format := fs.String("format", formatTable, formatUsage)
+	sticky := fs.Int("sticky", 0, "list apps whose rank stayed within a few places over the last N snapshots (0 disables)")
+	asOf := fs.String("as-of", "", "report on the latest snapshot at or before this time (RFC3339, or YYYY-MM-DD for the end of that day), classified with the theme config recorded then")
+	tz := fs.String("tz", "", tzDateUsage)
+	if err := parseFlags(fs, args); err != nil {
 		return err
 	}
+	if !analysis.ValidScoreMethod(*scoreMethodFlag) {
+		return fmt.Errorf("unsupported score method: %s", *scoreMethodFlag)
+	}
+
+	if *granularity != "theme" && *granularity != "genre" {
+		return fmt.Errorf("unsupported granularity: %s", *granularity)
+	}
+	if !validReportFormat(*format) {
+		return fmt.Errorf("unsupported format: %s", *format)
+	}
+	chartKey, err := chartKeyArg(*chart, *genre)
+	if err != nil {
+		return err
+	}
+
+	loc, err := seriesLocation(*tz, *country)
+	if err != nil {
+		return err
+	}
+	opts := reportOptions{CompareToYesterday: *compareToYesterday, StickyWindow: *sticky}
+	if *asOf != "" {
+		parsed, err := parseEndTimeArg(*asOf, loc)
+		if err != nil {
+			return fmt.Errorf("invalid --as-of: %w", err)
+		}
+		opts.AsOf = parsed
+	}
 
 	st, err := store.Open(*dbPath)
 	if err != nil {
@@ -115,60 +300,115 @@ func runReport(args []string) error {
 	}
 	defer st.Close()
 
-	payload, err := computeReport(st, *country, *chart, *themePath, analysis.TrendConfig{
-		RankWeight:    *rankWeight,
-		ReviewWeight:  *reviewWeight,
-		NewEntryBonus: *newEntryBonus,
-	})
+	cfg := analysis.TrendConfig{
+		RankWeight:      *rankWeight,
+		ReviewWeight:    *reviewWeight,
+		NewEntryBonus:   *newEntryBonus,
+		RatingAvgWeight: *ratingAvgWeight,
+		LaunchWindow:    time.Duration(*launchDays) * 24 * time.Hour,
+		NormalizePerDay: *normalizePerDay,
+		WeightedThemes:  *weightedThemes,
+		ScoreMethod:     *scoreMethodFlag,
+		Reclassify:      *reclassify,
+	}
+	ctx := context.Background()
+	payload, err := computeReport(ctx, st, *country, chartKey, themeFile(*themePath), cfg, opts)
 	if err != nil {
 		return err
 	}
 
-	if *topN > len(payload.Trends) {
-		*topN = len(payload.Trends)
+	render := renderOptions{TopN: *topN, GroupByTheme: *groupByTheme, Granularity: *granularity}
+	if *format != formatTSV {
+		render.RotationSuffix = rotationContext(ctx, st, *country, *chart, themeFile(*themePath), cfg, payload, *historyDays)
+	}
+	return renderReport(os.Stdout, payload, *format, render)
+}
+
+// rotationContext describes where the report's rotation index sits within its
+// own recent history, or returns "" when there is too little history.
+func rotationContext(ctx context.Context, st *store.Store, country, chart string, themes themeSource, cfg analysis.TrendConfig, payload reportPayload, days int) string {
+	if days <= 0 {
+		return ""
+	}
+	series, err := computeTimeSeries(ctx, st, country, chart, themes, cfg, timeSeriesOptions{})
+	if err != nil {
+		return ""
+	}
+	cutoff := payload.Latest.CollectedAt.AddDate(0, 0, -days)
+	var history []float64
+	for idx, date := range series.Dates {
+		at, err := time.Parse(time.RFC3339, date)
+		if err != nil || at.Before(cutoff) || at.After(payload.Latest.CollectedAt) {
+			continue
+		}
+		history = append(history, series.RotationIndex[idx])
 	}
+	if len(history) < 3 {
+		return ""
+	}
+	pct := analysis.PercentileRank(payload.RotationIndex, history)
+	return fmt.Sprintf(" (%s percentile of last %d days)", ordinal(int(math.Round(pct))), days)
+}
 
-	fmt.Printf("Latest snapshot: %s (%s %s)\n", payload.Latest.CollectedAt.Format(time.RFC3339), payload.Latest.Country, payload.Latest.Chart)
-	fmt.Printf("Previous snapshot: %s\n", payload.Previous.CollectedAt.Format(time.RFC3339))
-	fmt.Println()
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
 
-	fmt.Println("Most used (current rank):")
-	current := append([]analysis.AppTrend{}, payload.Trends...)
-	sort.Slice(current, func(i, j int) bool {
-		return current[i].Rank < current[j].Rank
-	})
-	for i := 0; i < *topN && i < len(current); i++ {
-		item := current[i]
-		fmt.Printf("%2d. #%d %s (%s)\n", i+1, item.Rank, item.AppName, item.Theme)
+// parseTimeArg accepts either an RFC3339 timestamp or a YYYY-MM-DD date (UTC midnight).
+// parseTimeArg parses an RFC3339 time, or a YYYY-MM-DD date as the start of
+// that day in loc.
+func parseTimeArg(value string, loc *time.Location) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed.UTC(), nil
 	}
-	fmt.Println()
+	return time.ParseInLocation("2006-01-02", value, loc)
+}
+
+// parseEndTimeArg is parseTimeArg for the end of a range: a date-only value
+// covers that whole day in loc, down to its last second.
+func parseEndTimeArg(value string, loc *time.Location) (time.Time, error) {
+	parsed, err := parseTimeArg(value, loc)
+	if err != nil || len(value) != len("2006-01-02") {
+		return parsed, err
+	}
+	return parsed.AddDate(0, 0, 1).Add(-time.Second), nil
+}
 
-	fmt.Println("Trending apps:")
-	for i := 0; i < *topN; i++ {
-		item := payload.Trends[i]
-		rankDelta := fmt.Sprintf("%+d", item.RankDelta)
-		reviewDelta := fmt.Sprintf("%+d", item.RatingDelta)
-		flags := []string{}
-		if item.NewEntry {
-			flags = append(flags, "new")
+// parseTimeRange parses --since and --until, either of which may be empty,
+// reading bare dates in loc. A date-only until covers that whole day.
+func parseTimeRange(since, until string, loc *time.Location) (time.Time, time.Time, error) {
+	var sinceTime, untilTime time.Time
+	var err error
+	if since != "" {
+		if sinceTime, err = parseTimeArg(since, loc); err != nil {
+			return sinceTime, untilTime, fmt.Errorf("invalid --since: %w", err)
 		}
-		meta := strings.Join(flags, ",")
-		if meta != "" {
-			meta = " [" + meta + "]"
+	}
+	if until != "" {
+		if untilTime, err = parseEndTimeArg(until, loc); err != nil {
+			return sinceTime, untilTime, fmt.Errorf("invalid --until: %w", err)
 		}
-		fmt.Printf("%2d. #%d %s (%s) rank %s reviews %s score %.2f%s\n",
-			i+1, item.Rank, item.AppName, item.Theme, rankDelta, reviewDelta, item.TrendScore, meta)
 	}
-	fmt.Println()
-
-	fmt.Println("Theme momentum:")
-	for _, pair := range payload.ThemeScores {
-		fmt.Printf("  %s: %.2f\n", pair.Theme, pair.Score)
+	if !sinceTime.IsZero() && !untilTime.IsZero() && sinceTime.After(untilTime) {
+		return sinceTime, untilTime, fmt.Errorf("--since %s is after --until %s", since, until)
 	}
-	fmt.Println()
+	return sinceTime, untilTime, nil
+}
 
-	fmt.Printf("Risk-on score: %.2f\n", payload.RiskOnScore)
-	fmt.Printf("Risk-off score: %.2f\n", payload.RiskOffScore)
-	fmt.Printf("Rotation index: %.2f\n", payload.RotationIndex)
-	return nil
+// chartKeyArg combines --chart and --genre into the store's chart key.
+func chartKeyArg(chart, genre string) (string, error) {
+	if genre != "" && !apple.ValidGenreID(genre) {
+		return "", fmt.Errorf("invalid --genre %q: must be a numeric genre id", genre)
+	}
+	return store.ChartKey(chart, genre), nil
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEndTimeArg(t *testing.T) {
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		value string
+		loc   *time.Location
+		want  string
+	}{
+		// A bare date covers the whole day in the given zone.
+		{"2024-01-05", time.UTC, "2024-01-05T23:59:59Z"},
+		{"2024-01-05", seoul, "2024-01-05T14:59:59Z"},
+		// An explicit time is taken as is, whatever the zone.
+		{"2024-01-05T03:00:00Z", seoul, "2024-01-05T03:00:00Z"},
+	}
+	for _, tt := range tests {
+		got, err := parseEndTimeArg(tt.value, tt.loc)
+		if err != nil {
+			t.Fatalf("parseEndTimeArg(%q): %v", tt.value, err)
+		}
+		if s := got.UTC().Format(time.RFC3339); s != tt.want {
+			t.Errorf("parseEndTimeArg(%q, %s) = %s, want %s", tt.value, tt.loc, s, tt.want)
+		}
+	}
+}
+
+func TestParseTimeRangeStartsDayInZone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	since, until, err := parseTimeRange("2024-01-05", "2024-01-05", tokyo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2024-01-04T15:00:00Z"; since.UTC().Format(time.RFC3339) != want {
+		t.Errorf("since = %s, want %s", since.UTC().Format(time.RFC3339), want)
+	}
+	if want := "2024-01-05T14:59:59Z"; until.UTC().Format(time.RFC3339) != want {
+		t.Errorf("until = %s, want %s", until.UTC().Format(time.RFC3339), want)
+	}
+}
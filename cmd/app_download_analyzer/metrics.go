@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"app_download_analyzer/internal/store"
+)
+
+// serverMetrics counts fetch outcomes for the /metrics endpoint.
+type serverMetrics struct {
+	fetches     atomic.Int64
+	failures    atomic.Int64
+	itemsStored atomic.Int64
+}
+
+// recordFetch counts one fetch run; count is the number of items stored
+// when err is nil.
+func (m *serverMetrics) recordFetch(count int, err error) {
+	m.fetches.Add(1)
+	if err != nil {
+		m.failures.Add(1)
+		return
+	}
+	m.itemsStored.Add(int64(count))
+}
+
+// handler serves the metrics in the Prometheus text exposition format. The
+// snapshot gauge is a count query read at scrape time, and like the health
+// probes it does not take the report mutex.
+func (m *serverMetrics) handler(st *store.Store, country, chart string, fetches *fetchTracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		writeMetric(&buf, "app_download_analyzer_fetches_total", "counter", "Fetch runs attempted, automatic or manual.", "", float64(m.fetches.Load()))
+		writeMetric(&buf, "app_download_analyzer_fetch_failures_total", "counter", "Fetch runs that failed.", "", float64(m.failures.Load()))
+		writeMetric(&buf, "app_download_analyzer_items_stored_total", "counter", "Chart items stored by fetch runs.", "", float64(m.itemsStored.Load()))
+
+		labels := fmt.Sprintf(`country=%q,chart=%q`, country, chart)
+		count, err := st.CountSnapshotsContext(r.Context(), country, chart)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeMetric(&buf, "app_download_analyzer_snapshots", "gauge", "Stored snapshots for the served country and chart.", labels, float64(count))
+		// Left out until the first fetch succeeds, so "absent" alerts can
+		// tell a stuck server from one that has never fetched.
+		if last := fetches.lastSuccess(); last != nil {
+			writeMetric(&buf, "app_download_analyzer_seconds_since_last_fetch", "gauge", "Seconds since the last successful fetch.", "", time.Since(*last).Seconds())
+		}
+		lastFailed := 0.0
+		if fetches.lastError() != nil {
+			lastFailed = 1
+		}
+		writeMetric(&buf, "app_download_analyzer_last_fetch_failed", "gauge", "1 if the latest fetch failed after its retries, else 0.", "", lastFailed)
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(buf.Bytes())
+	}
+}
+
+func writeMetric(buf *bytes.Buffer, name, kind, help, labels string, value float64) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, kind)
+	if labels != "" {
+		fmt.Fprintf(buf, "%s{%s} %g\n", name, labels, value)
+		return
+	}
+	fmt.Fprintf(buf, "%s %g\n", name, value)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"app_download_analyzer/internal/store"
+)
+
+func runPrune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	country := fs.String("country", "", "storefront country code (empty for all)")
+	chart := fs.String("chart", "", "chart name (empty for all)")
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	olderThan := fs.String("older-than", "", "delete snapshots older than this age (e.g. 30d, 72h)")
+	keepLast := fs.Int("keep-last", 0, "keep only the newest N snapshots per country/chart")
+	dryRun := fs.Bool("dry-run", false, "report what would be deleted without deleting")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *olderThan == "" && *keepLast <= 0 {
+		return fmt.Errorf("prune needs --older-than or --keep-last")
+	}
+	var age time.Duration
+	if *olderThan != "" {
+		var err error
+		if age, err = parseAge(*olderThan); err != nil {
+			return fmt.Errorf("invalid --older-than: %w", err)
+		}
+	}
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	var deleted []store.Snapshot
+	if *olderThan != "" {
+		snapshots, err := st.DeleteSnapshotsOlderThan(*country, *chart, time.Now().UTC().Add(-age), *dryRun)
+		if err != nil {
+			return err
+		}
+		deleted = append(deleted, snapshots...)
+	}
+	if *keepLast > 0 {
+		snapshots, err := st.DeleteSnapshotsKeepingLast(*country, *chart, *keepLast, *dryRun)
+		if err != nil {
+			return err
+		}
+		deleted = appendNewSnapshots(deleted, snapshots)
+	}
+
+	verb := "deleted"
+	if *dryRun {
+		verb = "would delete"
+	}
+	for _, snapshot := range deleted {
+		fmt.Printf("%s snapshot %d (%s %s/%s)\n", verb, snapshot.ID, snapshot.CollectedAt.Format(time.RFC3339), snapshot.Country, snapshot.Chart)
+	}
+	fmt.Printf("%s %d snapshots\n", verb, len(deleted))
+	return nil
+}
+
+// appendNewSnapshots appends snapshots not already present in list, so a dry
+// run matching both rules doesn't count a snapshot twice.
+func appendNewSnapshots(list, more []store.Snapshot) []store.Snapshot {
+	seen := make(map[int64]bool, len(list))
+	for _, snapshot := range list {
+		seen[snapshot.ID] = true
+	}
+	for _, snapshot := range more {
+		if !seen[snapshot.ID] {
+			list = append(list, snapshot)
+		}
+	}
+	return list
+}
+
+// parseAge parses a Go duration, additionally accepting a whole number of
+// days such as "30d". The age must be positive: a zero or negative age
+// would put the cutoff at or after now and prune every snapshot.
+func parseAge(value string) (time.Duration, error) {
+	var age time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		age = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if age, err = time.ParseDuration(value); err != nil {
+			return 0, err
+		}
+	}
+	if age <= 0 {
+		return 0, fmt.Errorf("age must be positive, got %s", value)
+	}
+	return age, nil
+}
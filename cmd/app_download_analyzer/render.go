@@ -0,0 +1,376 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"app_download_analyzer/internal/analysis"
+	"app_download_analyzer/internal/store"
+)
+
+const (
+	formatTable    = "table"
+	formatMarkdown = "markdown"
+	formatTSV      = "tsv"
+)
+
+const formatUsage = "output format (table, markdown, tsv)"
+
+func validReportFormat(format string) bool {
+	return format == formatTable || format == formatMarkdown || format == formatTSV
+}
+
+// renderOptions controls how much of a report is rendered.
+type renderOptions struct {
+	TopN         int
+	GroupByTheme bool
+	// Granularity is "theme" or "genre" for the momentum section.
+	Granularity string
+	// RotationSuffix is appended to the rotation index line.
+	RotationSuffix string
+}
+
+// renderReport writes a report in the given format: the human-readable
+// table layout, Markdown for pasting into chat or issues, or TSV with one
+// trending app per line.
+func renderReport(w io.Writer, payload reportPayload, format string, opts renderOptions) error {
+	if opts.TopN > len(payload.Trends) {
+		opts.TopN = len(payload.Trends)
+	}
+	switch format {
+	case formatTable:
+		renderTable(w, payload, opts)
+	case formatMarkdown:
+		renderMarkdown(w, payload, opts)
+	case formatTSV:
+		renderTSV(w, payload, opts)
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	return nil
+}
+
+func renderTable(w io.Writer, payload reportPayload, opts renderOptions) {
+	fmt.Fprintf(w, "Latest snapshot: %s (%s %s)%s\n", payload.Latest.CollectedAt.Format(time.RFC3339), payload.Latest.Country, store.ChartKey(payload.Latest.Chart, payload.Latest.Genre), tagSuffix(payload.Latest.Tag))
+	fmt.Fprintf(w, "Previous snapshot: %s%s\n", payload.Previous.CollectedAt.Format(time.RFC3339), tagSuffix(payload.Previous.Tag))
+	if payload.ThemeRotation != nil {
+		fmt.Fprintf(w, "Headline: %s\n", payload.ThemeRotation.Headline())
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Most used (current rank):")
+	for i, item := range currentRanking(payload, opts.TopN) {
+		fmt.Fprintf(w, "%2d. #%d %s (%s)\n", i+1, item.Rank, item.AppName, item.Theme)
+	}
+	fmt.Fprintln(w)
+
+	if opts.GroupByTheme {
+		fmt.Fprintln(w, "Trending apps by theme:")
+		for _, pair := range payload.ThemeScores {
+			fmt.Fprintf(w, "  %s (%.2f):\n", pair.Theme, pair.Score)
+			for n, item := range themeTrends(payload, pair.Theme, opts.TopN) {
+				fmt.Fprintf(w, "  %2d. %s\n", n+1, formatTrendLine(item))
+			}
+		}
+	} else {
+		fmt.Fprintln(w, "Trending apps:")
+		for i := 0; i < opts.TopN; i++ {
+			fmt.Fprintf(w, "%2d. %s\n", i+1, formatTrendLine(payload.Trends[i]))
+		}
+	}
+	fmt.Fprintln(w)
+
+	if len(payload.Exits) > 0 {
+		fmt.Fprintln(w, "Falling off:")
+		for i, exit := range payload.Exits {
+			if i >= opts.TopN {
+				fmt.Fprintf(w, "    ... and %d more\n", len(payload.Exits)-opts.TopN)
+				break
+			}
+			fmt.Fprintf(w, "%2d. %s (was #%d, %s)\n", i+1, exit.AppName, exit.PreviousRank, exit.Theme)
+		}
+		fmt.Fprintln(w)
+	}
+
+	label, scores, counts := momentumScores(payload, opts.Granularity)
+	fmt.Fprintf(w, "%s:\n", momentumTitle(label, payload.ChartKind))
+	for _, pair := range scores {
+		fmt.Fprintf(w, "  %s: %.2f (%s)\n", pair.Theme, pair.Score, appCount(counts[pair.Theme]))
+	}
+	fmt.Fprintln(w)
+
+	if deviation := themeDeviation(payload); len(deviation) > 0 {
+		fmt.Fprintf(w, "%s vs weekday baseline:\n", momentumTitle("Theme", payload.ChartKind))
+		for _, pair := range deviation {
+			fmt.Fprintf(w, "  %s: %+.2f\n", pair.Theme, pair.Score)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(payload.StickyApps) > 0 {
+		fmt.Fprintf(w, "Sticky apps (rank within %d places):\n", analysis.StickyBand)
+		for i, app := range payload.StickyApps {
+			fmt.Fprintf(w, "%2d. %s (mean #%.1f, #%d-#%d, variance %.2f)\n", i+1, app.AppName, app.MeanRank, app.BestRank, app.WorstRank, app.RankVariance)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "Risk-on score%s: %.2f\n", riskSuffix(payload.ChartKind), payload.RiskOnScore)
+	fmt.Fprintf(w, "Risk-off score%s: %.2f\n", riskSuffix(payload.ChartKind), payload.RiskOffScore)
+	fmt.Fprintf(w, "Rotation index: %.2f%s\n", payload.RotationIndex, opts.RotationSuffix)
+	fmt.Fprintf(w, "Volatility: %.2f\n", payload.Volatility)
+	for _, name := range indexNames(payload.Indexes) {
+		fmt.Fprintf(w, "Index %s: %.2f\n", name, payload.Indexes[name])
+	}
+}
+
+func renderMarkdown(w io.Writer, payload reportPayload, opts renderOptions) {
+	fmt.Fprintf(w, "## %s %s\n\n", payload.Latest.Country, store.ChartKey(payload.Latest.Chart, payload.Latest.Genre))
+	fmt.Fprintf(w, "Latest snapshot %s%s, compared with %s%s.\n\n",
+		payload.Latest.CollectedAt.Format(time.RFC3339), tagSuffix(payload.Latest.Tag),
+		payload.Previous.CollectedAt.Format(time.RFC3339), tagSuffix(payload.Previous.Tag))
+	if payload.ThemeRotation != nil {
+		fmt.Fprintf(w, "**Headline:** %s\n\n", payload.ThemeRotation.Headline())
+	}
+
+	fmt.Fprintln(w, "### Trending apps")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| # | Rank | App | Theme | Rank Δ | Reviews Δ | Score | New |")
+	fmt.Fprintln(w, "|--:|--:|:--|:--|--:|--:|--:|:-:|")
+	for i, item := range trendingRows(payload, opts) {
+		newEntry := ""
+		if flags := trendFlags(item); len(flags) > 0 {
+			newEntry = strings.Join(flags, ", ")
+		}
+		fmt.Fprintf(w, "| %d | %d | %s | %s | %+d | %s | %.2f | %s |\n",
+			i+1, item.Rank, markdownCell(item.AppName), markdownCell(item.Theme), item.RankDelta, formatRatingDelta(item), item.TrendScore, newEntry)
+	}
+	fmt.Fprintln(w)
+
+	if len(payload.Exits) > 0 {
+		fmt.Fprintln(w, "### Falling off")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| # | App | Was | Theme |")
+		fmt.Fprintln(w, "|--:|:--|--:|:--|")
+		for i, exit := range payload.Exits {
+			if i >= opts.TopN {
+				break
+			}
+			fmt.Fprintf(w, "| %d | %s | #%d | %s |\n", i+1, markdownCell(exit.AppName), exit.PreviousRank, markdownCell(exit.Theme))
+		}
+		fmt.Fprintln(w)
+	}
+
+	label, scores, counts := momentumScores(payload, opts.Granularity)
+	fmt.Fprintf(w, "### %s\n\n", momentumTitle(label, payload.ChartKind))
+	fmt.Fprintf(w, "| %s | Score | Apps |\n", label)
+	fmt.Fprintln(w, "|:--|--:|--:|")
+	for _, pair := range scores {
+		fmt.Fprintf(w, "| %s | %.2f | %d |\n", markdownCell(pair.Theme), pair.Score, counts[pair.Theme])
+	}
+	fmt.Fprintln(w)
+
+	if deviation := themeDeviation(payload); len(deviation) > 0 {
+		fmt.Fprintf(w, "### %s vs weekday baseline\n\n", momentumTitle("Theme", payload.ChartKind))
+		fmt.Fprintln(w, "| Theme | Deviation |")
+		fmt.Fprintln(w, "|:--|--:|")
+		for _, pair := range deviation {
+			fmt.Fprintf(w, "| %s | %+.2f |\n", markdownCell(pair.Theme), pair.Score)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(payload.StickyApps) > 0 {
+		fmt.Fprintf(w, "### Sticky apps (rank within %d places)\n\n", analysis.StickyBand)
+		fmt.Fprintln(w, "| App | Mean rank | Best | Worst | Variance |")
+		fmt.Fprintln(w, "|:--|--:|--:|--:|--:|")
+		for _, app := range payload.StickyApps {
+			fmt.Fprintf(w, "| %s | %.1f | %d | %d | %.2f |\n", markdownCell(app.AppName), app.MeanRank, app.BestRank, app.WorstRank, app.RankVariance)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "- Risk-on score%s: %.2f\n", riskSuffix(payload.ChartKind), payload.RiskOnScore)
+	fmt.Fprintf(w, "- Risk-off score%s: %.2f\n", riskSuffix(payload.ChartKind), payload.RiskOffScore)
+	fmt.Fprintf(w, "- Rotation index: %.2f%s\n", payload.RotationIndex, opts.RotationSuffix)
+	fmt.Fprintf(w, "- Volatility: %.2f\n", payload.Volatility)
+	for _, name := range indexNames(payload.Indexes) {
+		fmt.Fprintf(w, "- Index %s: %.2f\n", markdownCell(name), payload.Indexes[name])
+	}
+}
+
+// tagSuffix shows a snapshot's tag after its time, or nothing when it has
+// none.
+func tagSuffix(tag string) string {
+	if tag == "" {
+		return ""
+	}
+	return " [" + tag + "]"
+}
+
+// indexNames returns the custom index names in a stable order.
+func indexNames(indexes map[string]float64) []string {
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func renderTSV(w io.Writer, payload reportPayload, opts renderOptions) {
+	fmt.Fprintln(w, strings.Join([]string{"position", "rank", "app_id", "app_name", "theme", "genre", "rank_delta", "rating_delta", "trend_score", "new_entry", "recently_released"}, "\t"))
+	for i, item := range trendingRows(payload, opts) {
+		ratingDelta := ""
+		if item.RatingDelta != nil {
+			ratingDelta = strconv.Itoa(*item.RatingDelta)
+		}
+		fmt.Fprintln(w, strings.Join([]string{
+			strconv.Itoa(i + 1),
+			strconv.Itoa(item.Rank),
+			item.AppID,
+			tsvCell(item.AppName),
+			tsvCell(item.Theme),
+			tsvCell(item.Genre),
+			strconv.Itoa(item.RankDelta),
+			ratingDelta,
+			strconv.FormatFloat(item.TrendScore, 'f', 4, 64),
+			strconv.FormatBool(item.NewEntry),
+			strconv.FormatBool(item.RecentlyReleased),
+		}, "\t"))
+	}
+}
+
+// currentRanking returns the first n apps by current chart rank.
+func currentRanking(payload reportPayload, n int) []analysis.AppTrend {
+	current := append([]analysis.AppTrend{}, payload.Trends...)
+	sort.Slice(current, func(i, j int) bool {
+		return current[i].Rank < current[j].Rank
+	})
+	if n < len(current) {
+		current = current[:n]
+	}
+	return current
+}
+
+// themeTrends returns up to n of the theme's apps in trend order.
+func themeTrends(payload reportPayload, theme string, n int) []analysis.AppTrend {
+	var out []analysis.AppTrend
+	for _, item := range payload.Trends {
+		if len(out) >= n {
+			break
+		}
+		if item.Theme == theme {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// trendingRows flattens the trending section into rows: the top apps
+// overall, or the top apps of each theme in momentum order when grouped.
+func trendingRows(payload reportPayload, opts renderOptions) []analysis.AppTrend {
+	if !opts.GroupByTheme {
+		return payload.Trends[:opts.TopN]
+	}
+	var rows []analysis.AppTrend
+	for _, pair := range payload.ThemeScores {
+		rows = append(rows, themeTrends(payload, pair.Theme, opts.TopN)...)
+	}
+	return rows
+}
+
+// momentumScores returns the momentum section's label, its scores, and the
+// number of apps behind each score.
+func momentumScores(payload reportPayload, granularity string) (string, []analysis.ThemeScore, map[string]int) {
+	if granularity == "genre" {
+		counts := map[string]int{}
+		for _, trend := range payload.Trends {
+			counts[trend.Genre]++
+		}
+		return "Genre", analysis.SortThemeScores(analysis.GenreScores(payload.Trends)), counts
+	}
+	return "Theme", payload.ThemeScores, payload.ThemeCounts
+}
+
+// momentumTitle names a momentum section. Grossing ranks follow earnings,
+// so their movements read as revenue momentum.
+func momentumTitle(label string, kind analysis.ChartKind) string {
+	if kind == analysis.ChartKindRevenue {
+		return label + " revenue momentum"
+	}
+	return label + " momentum"
+}
+
+// riskSuffix marks risk-on/off scores computed from grossing ranks, which
+// weigh themes by what they earn rather than by downloads.
+func riskSuffix(kind analysis.ChartKind) string {
+	if kind == analysis.ChartKindRevenue {
+		return " (revenue-weighted)"
+	}
+	return ""
+}
+
+func appCount(n int) string {
+	if n == 1 {
+		return "1 app"
+	}
+	return fmt.Sprintf("%d apps", n)
+}
+
+// themeDeviation returns the weekday-adjusted theme scores, or nil when
+// there was too little history to compute them.
+func themeDeviation(payload reportPayload) []analysis.ThemeScore {
+	for _, pair := range payload.ThemeScoresDeviation {
+		if pair.Score != 0 {
+			return payload.ThemeScoresDeviation
+		}
+	}
+	return nil
+}
+
+func formatRatingDelta(item analysis.AppTrend) string {
+	if item.RatingDelta == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+d", *item.RatingDelta)
+}
+
+func markdownCell(value string) string {
+	return strings.ReplaceAll(value, "|", `\|`)
+}
+
+func tsvCell(value string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ").Replace(value)
+}
+
+// trendFlags labels a trend "launch" when the app was released recently and
+// "new" when it entered the chart without being a launch, i.e. re-entered
+// or was released long ago.
+func trendFlags(item analysis.AppTrend) []string {
+	switch {
+	case item.RecentlyReleased:
+		return []string{"launch"}
+	case item.NewEntry:
+		return []string{"new"}
+	}
+	return nil
+}
+
+func formatTrendLine(item analysis.AppTrend) string {
+	rankDelta := fmt.Sprintf("%+d", item.RankDelta)
+	reviewDelta := formatRatingDelta(item)
+	meta := strings.Join(trendFlags(item), ",")
+	if meta != "" {
+		meta = " [" + meta + "]"
+	}
+	if item.AverageRatingDelta != nil {
+		reviewDelta += fmt.Sprintf(" rating %+.2f", *item.AverageRatingDelta)
+	}
+	return fmt.Sprintf("#%d %s (%s) rank %s reviews %s score %.2f%s",
+		item.Rank, item.AppName, item.Theme, rankDelta, reviewDelta, item.TrendScore, meta)
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"log/slog"
+	"strings"
 	"time"
 
 	"app_download_analyzer/internal/analysis"
+	"app_download_analyzer/internal/apple"
 	"app_download_analyzer/internal/store"
+	"app_download_analyzer/internal/version"
 )
 
 type reportSnapshot struct {
@@ -14,77 +19,348 @@ type reportSnapshot struct {
 	CollectedAt time.Time `json:"collected_at"`
 	Country     string    `json:"country"`
 	Chart       string    `json:"chart"`
+	Genre       string    `json:"genre,omitempty"`
 	Limit       int       `json:"limit"`
 	SourceURL   string    `json:"source_url"`
+	Tag         string    `json:"tag,omitempty"`
 }
 
+func newReportSnapshot(snapshot store.Snapshot) reportSnapshot {
+	return reportSnapshot{
+		ID:          snapshot.ID,
+		CollectedAt: snapshot.CollectedAt,
+		Country:     snapshot.Country,
+		Chart:       snapshot.Chart,
+		Genre:       snapshot.Genre,
+		Limit:       snapshot.Limit,
+		SourceURL:   snapshot.SourceURL,
+		Tag:         snapshot.Tag,
+	}
+}
+
+// reportOptions selects which snapshots a report covers.
+type reportOptions struct {
+	// AsOf, when set, reports on the latest snapshot at or before this time
+	// and classifies it with the theme config recorded at fetch time.
+	AsOf time.Time
+	// CompareToYesterday compares against the snapshot closest to 24 hours
+	// before the latest one instead of the immediately preceding snapshot.
+	CompareToYesterday bool
+	// StickyWindow, when positive, lists the apps that held their rank over
+	// this many snapshots up to latest.
+	StickyWindow int
+	// RequirePrevious fails with analysis.ErrInsufficientHistory when there
+	// is nothing to compare against, instead of comparing the latest
+	// snapshot with itself.
+	RequirePrevious bool
+	// Pending is the id of a snapshot whose deferred enrichment is still
+	// running. While it is the latest, the report stays on the snapshot
+	// before it, unless there is none.
+	Pending int64
+}
+
+// reportSchemaVersion is reportPayload's schema_version. Bump it whenever a
+// field is renamed, removed or changes meaning.
+const reportSchemaVersion = 2
+
 type reportPayload struct {
+	SchemaVersion int                   `json:"schema_version"`
+	GeneratedBy   string                `json:"generated_by"`
 	Latest        reportSnapshot        `json:"latest"`
 	Previous      reportSnapshot        `json:"previous"`
 	GeneratedAt   time.Time             `json:"generated_at"`
+	ChartKind     analysis.ChartKind    `json:"chart_kind"`
+	ScoreMethod   string                `json:"score_method"`
 	Trends        []analysis.AppTrend   `json:"trends"`
+	Exits         []analysis.AppExit    `json:"exits,omitempty"`
 	ThemeScores   []analysis.ThemeScore `json:"theme_scores"`
-	RiskOnScore   float64               `json:"risk_on_score"`
-	RiskOffScore  float64               `json:"risk_off_score"`
-	RotationIndex float64               `json:"rotation_index"`
+	// ThemeCounts is how many apps each theme score averages over.
+	ThemeCounts   map[string]int `json:"theme_counts"`
+	RiskOnScore   float64        `json:"risk_on_score"`
+	RiskOffScore  float64        `json:"risk_off_score"`
+	RotationIndex float64        `json:"rotation_index"`
+	Volatility    float64        `json:"volatility"`
+	// Indexes are the custom indexes defined under "indexes" in the theme
+	// config, by name.
+	Indexes map[string]float64 `json:"indexes,omitempty"`
+	// ThemeScoresDeviation is each theme's score minus its mean on the same
+	// weekday over recent history; all zero without enough history.
+	ThemeScoresDeviation []analysis.ThemeScore   `json:"theme_scores_deviation"`
+	ThemeRotation        *analysis.ThemeRotation `json:"theme_rotation,omitempty"`
+	// StickyApps are set only when sticky detection was requested.
+	StickyApps []analysis.StickyApp `json:"sticky_apps,omitempty"`
+}
+
+// reportTarget returns the snapshot a report with opts is on.
+func reportTarget(ctx context.Context, st *store.Store, country, chart string, opts reportOptions) (store.Snapshot, error) {
+	var latest store.Snapshot
+	var err error
+	if opts.AsOf.IsZero() {
+		latest, err = st.GetLatestSnapshotContext(ctx, country, chart)
+	} else {
+		latest, err = st.GetSnapshotAsOfContext(ctx, country, chart, opts.AsOf)
+	}
+	if err != nil || opts.Pending == 0 || latest.ID != opts.Pending {
+		return latest, err
+	}
+	previous, err := st.GetPreviousSnapshotContext(ctx, country, chart, latest.CollectedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return latest, nil
+	}
+	return previous, err
 }
 
-func computeReport(st *store.Store, country, chart, themePath string, cfg analysis.TrendConfig) (reportPayload, error) {
-	latest, err := st.GetLatestSnapshot(country, chart)
+func computeReport(ctx context.Context, st *store.Store, country, chart string, themes themeSource, cfg analysis.TrendConfig, opts reportOptions) (reportPayload, error) {
+	latest, err := reportTarget(ctx, st, country, chart, opts)
 	if err != nil {
 		return reportPayload{}, err
 	}
 
-	latestItems, err := st.GetSnapshotItems(latest.ID)
+	latestItems, err := st.GetSnapshotItemsContext(ctx, latest.ID)
 	if err != nil {
 		return reportPayload{}, err
 	}
-	previous, err := st.GetPreviousSnapshot(country, chart, latest.CollectedAt)
+	var previous store.Snapshot
+	if opts.CompareToYesterday {
+		previous, err = st.GetSnapshotNearestTimeContext(ctx, country, chart, latest.CollectedAt.Add(-24*time.Hour))
+		if err == nil && !previous.CollectedAt.Before(latest.CollectedAt) {
+			err = sql.ErrNoRows
+		}
+	} else {
+		previous, err = st.GetPreviousSnapshotContext(ctx, country, chart, latest.CollectedAt)
+	}
 	var prevItems []store.ChartItem
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
+			if opts.RequirePrevious {
+				return reportPayload{}, analysis.ErrInsufficientHistory
+			}
 			previous = latest
 			prevItems = latestItems
 		} else {
 			return reportPayload{}, err
 		}
 	} else {
-		prevItems, err = st.GetSnapshotItems(previous.ID)
+		prevItems, err = st.GetSnapshotItemsContext(ctx, previous.ID)
 		if err != nil {
 			return reportPayload{}, err
 		}
 	}
 
-	themeConfig, err := analysis.LoadThemeConfig(themePath)
+	var themeConfig analysis.ThemeConfig
+	if !opts.AsOf.IsZero() && latest.ThemeConfigID != 0 {
+		themeConfig, err = loadStoredThemeConfig(ctx, st, latest.ThemeConfigID)
+	} else {
+		themeConfig, _, err = themes.themeConfig()
+	}
 	if err != nil {
 		return reportPayload{}, err
 	}
 
+	payload, err := buildReport(ctx, st, latest, previous, latestItems, prevItems, cfg, themeConfig)
+	if err != nil {
+		return reportPayload{}, err
+	}
+	if err := applyRankMomentum(ctx, st, latest, payload.Trends); err != nil {
+		return reportPayload{}, err
+	}
+	if err := applyThemeDeviation(ctx, st, latest, latestItems, cfg, themeConfig, &payload); err != nil {
+		return reportPayload{}, err
+	}
+	if opts.StickyWindow > 0 {
+		payload.StickyApps, err = stickyApps(ctx, st, latest, opts.StickyWindow)
+		if err != nil {
+			return reportPayload{}, err
+		}
+	}
+	return payload, nil
+}
+
+// stickyApps finds the apps that held their rank over the window snapshots
+// ending with latest.
+func stickyApps(ctx context.Context, st *store.Store, latest store.Snapshot, window int) ([]analysis.StickyApp, error) {
+	snapshots, err := st.ListSnapshotsBetweenContext(ctx, latest.Country, latest.ChartKey(), time.Time{}, latest.CollectedAt)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) > window {
+		snapshots = snapshots[len(snapshots)-window:]
+	}
+	items := make([][]store.ChartItem, len(snapshots))
+	for i, snapshot := range snapshots {
+		items[i], err = st.GetSnapshotItemsContext(ctx, snapshot.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return analysis.StickyApps(snapshots, items, window), nil
+}
+
+// seasonalityWindow bounds the history used for day-of-week baselines.
+const seasonalityWindow = 8 * 7 * 24 * time.Hour
+
+// applyThemeDeviation sets the payload's ThemeScoresDeviation against
+// day-of-week baselines built from the daily snapshots before latest's day,
+// grouped one per day of the storefront's time zone as in the time series.
+// Latest is scored against the previous day's snapshot, like every day of
+// the baseline, rather than against whichever snapshot preceded it.
+func applyThemeDeviation(ctx context.Context, st *store.Store, latest store.Snapshot, latestItems []store.ChartItem, cfg analysis.TrendConfig, themeConfig analysis.ThemeConfig, payload *reportPayload) error {
+	loc := storefrontLocation(latest.Country)
+	today := analysis.DailyThemeScores{
+		Day:    latest.DataTime().In(loc),
+		Scores: make(map[string]float64, len(payload.ThemeScores)),
+	}
+	for _, pair := range payload.ThemeScores {
+		today.Scores[pair.Theme] = pair.Score
+	}
+	latestDay := periodKey(today.Day, periodDay, loc)
+
+	snapshots, err := st.ListSnapshotsContext(ctx, latest.Country, latest.ChartKey())
+	if err != nil {
+		return err
+	}
+	since := today.Day.Add(-seasonalityWindow)
+	var window []store.Snapshot
+	days := map[string]bool{}
+	for _, snapshot := range snapshots {
+		at := snapshot.DataTime()
+		day := periodKey(at, periodDay, loc)
+		if at.Before(since) || snapshot.CollectedAt.After(latest.CollectedAt) || day == latestDay {
+			continue
+		}
+		window = append(window, snapshot)
+		days[day] = true
+	}
+
+	var history []analysis.DailyThemeScores
+	// Each day is scored against the day before it, so the window needs one
+	// more day than the baseline does.
+	if len(days) > analysis.MinSeasonalityDays {
+		items := make([][]store.ChartItem, len(window))
+		for i, snapshot := range window {
+			items[i], err = st.GetSnapshotItemsContext(ctx, snapshot.ID)
+			if err != nil {
+				return err
+			}
+		}
+		daily, dailyItems := groupSnapshotsByPeriod(window, items, periodDay, loc)
+		for i := 1; i < len(daily); i++ {
+			result := analysis.AnalyzeTrends(daily[i], daily[i-1], dailyItems[i], dailyItems[i-1], cfg, themeConfig)
+			history = append(history, analysis.DailyThemeScores{
+				Day:    daily[i].DataTime().In(loc),
+				Scores: result.ThemeScores,
+			})
+		}
+		last := len(daily) - 1
+		today.Scores = analysis.AnalyzeTrends(latest, daily[last], latestItems, dailyItems[last], cfg, themeConfig).ThemeScores
+	}
+	payload.ThemeScoresDeviation = analysis.SortThemeScores(analysis.ThemeScoresDeviation(today, history))
+	return nil
+}
+
+// largeArtworkSize is the icon size, in pixels, of the artwork_url_large
+// fields, for high-density displays.
+const largeArtworkSize = 512
+
+// momentumWindow is the number of snapshots, including the latest, used for
+// rank velocity and acceleration.
+const momentumWindow = 5
+
+// applyRankMomentum fills rank velocity and acceleration from the snapshots
+// leading up to latest. It does nothing when latest is not the newest
+// snapshot, e.g. for --as-of reports.
+func applyRankMomentum(ctx context.Context, st *store.Store, latest store.Snapshot, trends []analysis.AppTrend) error {
+	snapshots, err := st.ListRecentSnapshotsContext(ctx, latest.Country, latest.ChartKey(), momentumWindow)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) < 2 || snapshots[len(snapshots)-1].ID != latest.ID {
+		return nil
+	}
+	items := make([][]store.ChartItem, len(snapshots))
+	for i, snapshot := range snapshots {
+		items[i], err = st.GetSnapshotItemsContext(ctx, snapshot.ID)
+		if err != nil {
+			return err
+		}
+	}
+	analysis.ApplyRankMomentum(trends, snapshots, items)
+	return nil
+}
+
+// buildReport analyzes latest against previous and assembles the payload
+// shared by report, report-json and compare.
+func buildReport(ctx context.Context, st *store.Store, latest, previous store.Snapshot, latestItems, prevItems []store.ChartItem, cfg analysis.TrendConfig, themeConfig analysis.ThemeConfig) (reportPayload, error) {
 	result := analysis.AnalyzeTrends(latest, previous, latestItems, prevItems, cfg, themeConfig)
+	for i := range result.Trends {
+		result.Trends[i].ArtworkURLLarge = apple.ArtworkURL(result.Trends[i].ArtworkURL, largeArtworkSize)
+	}
+	if len(result.Ignored) > 0 {
+		slog.Info("ignored apps matching ignore_patterns", "count", len(result.Ignored), "apps", strings.Join(result.Ignored, ", "))
+	}
 
 	payload := reportPayload{
-		Latest: reportSnapshot{
-			ID:          latest.ID,
-			CollectedAt: latest.CollectedAt,
-			Country:     latest.Country,
-			Chart:       latest.Chart,
-			Limit:       latest.Limit,
-			SourceURL:   latest.SourceURL,
-		},
-		Previous: reportSnapshot{
-			ID:          previous.ID,
-			CollectedAt: previous.CollectedAt,
-			Country:     previous.Country,
-			Chart:       previous.Chart,
-			Limit:       previous.Limit,
-			SourceURL:   previous.SourceURL,
-		},
+		Latest:        newReportSnapshot(latest),
+		Previous:      newReportSnapshot(previous),
+		SchemaVersion: reportSchemaVersion,
+		GeneratedBy:   version.String,
 		GeneratedAt:   time.Now().UTC(),
+		ChartKind:     analysis.ChartKindOf(latest.Chart),
+		ScoreMethod:   scoreMethod(cfg),
 		Trends:        result.Trends,
+		Exits:         result.Exits,
 		ThemeScores:   analysis.SortThemeScores(result.ThemeScores),
+		ThemeCounts:   result.ThemeCounts,
 		RiskOnScore:   result.RiskOnScore,
 		RiskOffScore:  result.RiskOffScore,
 		RotationIndex: result.RotationIndex,
+		Volatility:    result.Volatility,
+		Indexes:       result.Indexes,
+	}
+
+	if previous.ID != latest.ID {
+		priorScores, err := priorThemeScores(ctx, st, previous, prevItems, cfg, themeConfig)
+		if err != nil {
+			return reportPayload{}, err
+		}
+		if priorScores != nil {
+			if rotation, ok := analysis.CompareThemeScores(priorScores, result.ThemeScores); ok {
+				payload.ThemeRotation = &rotation
+			}
+		}
 	}
 	return payload, nil
 }
+
+// priorThemeScores analyzes previous against the snapshot before it, so the
+// report can say which themes gained or lost momentum. It returns nil when
+// previous is the oldest snapshot.
+func priorThemeScores(ctx context.Context, st *store.Store, previous store.Snapshot, prevItems []store.ChartItem, cfg analysis.TrendConfig, themeConfig analysis.ThemeConfig) (map[string]float64, error) {
+	prior, err := st.GetPreviousSnapshotContext(ctx, previous.Country, previous.ChartKey(), previous.CollectedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	priorItems, err := st.GetSnapshotItemsContext(ctx, prior.ID)
+	if err != nil {
+		return nil, err
+	}
+	return analysis.AnalyzeTrends(previous, prior, prevItems, priorItems, cfg, themeConfig).ThemeScores, nil
+}
+
+func scoreMethod(cfg analysis.TrendConfig) string {
+	if cfg.ScoreMethod == "" {
+		return analysis.ScoreZScore
+	}
+	return cfg.ScoreMethod
+}
+
+func loadStoredThemeConfig(ctx context.Context, st *store.Store, id int64) (analysis.ThemeConfig, error) {
+	record, err := st.GetThemeConfigContext(ctx, id)
+	if err != nil {
+		return analysis.ThemeConfig{}, err
+	}
+	return analysis.ParseThemeConfig(record.Content)
+}
@@ -1,28 +1,85 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"os"
+	"log/slog"
+	"time"
 
 	"app_download_analyzer/internal/analysis"
 	"app_download_analyzer/internal/store"
+	"app_download_analyzer/internal/version"
 )
 
+// reportErrorPayload is what report-json writes in place of a report when
+// the chart has too little data to compare, so a pipeline can tell an empty
+// chart from a failure without parsing logs.
+type reportErrorPayload struct {
+	SchemaVersion int    `json:"schema_version"`
+	GeneratedBy   string `json:"generated_by"`
+	Country       string `json:"country"`
+	Chart         string `json:"chart"`
+	// Error is "no_snapshots" or "insufficient_history".
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// noDataCode is reportErrorPayload's error code for err, or "" when err is
+// nil or a real failure.
+func noDataCode(err error) string {
+	switch {
+	case errors.Is(err, store.ErrNoSnapshots):
+		return "no_snapshots"
+	case errors.Is(err, analysis.ErrInsufficientHistory):
+		return "insufficient_history"
+	}
+	return ""
+}
+
 func runReportJSON(args []string) error {
 	fs := flag.NewFlagSet("report-json", flag.ExitOnError)
 	country := fs.String("country", defaultCountry, "storefront country code")
-	chart := fs.String("chart", defaultChart, "chart name (top-free, top-paid)")
+	chart := fs.String("chart", defaultChart, chartUsage)
 	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
 	themePath := fs.String("themes", "config/themes.json", "theme rules json")
 	outPath := fs.String("out", "report.json", "output file path or '-' for stdout")
 	rankWeight := fs.Float64("rank-weight", 1.0, "weight for rank delta z-score")
 	reviewWeight := fs.Float64("review-weight", 1.0, "weight for review growth z-score")
 	newEntryBonus := fs.Float64("new-bonus", 0.5, "bonus for new chart entries")
-	if err := fs.Parse(args); err != nil {
+	ratingAvgWeight := fs.Float64("rating-avg-weight", 0, "weight for average rating delta (0 leaves it out of the score)")
+	launchDays := fs.Int("launch-days", 30, "flag apps released within this many days of the snapshot as launches")
+	normalizePerDay := fs.Bool("normalize-per-day", false, "add each app's rating growth per day between snapshots (display only)")
+	weightedThemes := fs.Bool("weighted-themes", false, "spread apps across all matching themes when scoring momentum")
+	scoreMethodFlag := fs.String("score-method", analysis.ScoreZScore, "delta scoring (zscore, percentile)")
+	reclassify := fs.Bool("reclassify", false, "classify apps with the current theme config instead of the stored themes")
+	genre := fs.String("genre", "", "report on the chart fetched with this --genre id")
+	sticky := fs.Int("sticky", 0, "list apps whose rank stayed within a few places over the last N snapshots (0 disables)")
+	humanize := fs.Bool("humanize-counts", false, "add abbreviated rating count display fields")
+	asOf := fs.String("as-of", "", "report on the latest snapshot at or before this time (RFC3339, or YYYY-MM-DD for the end of that day), classified with the theme config recorded then")
+	tz := fs.String("tz", "", tzDateUsage)
+	output := registerJSONFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
 		return err
 	}
+	if !analysis.ValidScoreMethod(*scoreMethodFlag) {
+		return fmt.Errorf("unsupported score method: %s", *scoreMethodFlag)
+	}
+	chartKey, err := chartKeyArg(*chart, *genre)
+	if err != nil {
+		return err
+	}
+	opts := reportOptions{StickyWindow: *sticky, RequirePrevious: true}
+	if *asOf != "" {
+		loc, err := seriesLocation(*tz, *country)
+		if err != nil {
+			return err
+		}
+		if opts.AsOf, err = parseEndTimeArg(*asOf, loc); err != nil {
+			return fmt.Errorf("invalid --as-of: %w", err)
+		}
+	}
 
 	st, err := store.Open(*dbPath)
 	if err != nil {
@@ -30,34 +87,34 @@ func runReportJSON(args []string) error {
 	}
 	defer st.Close()
 
-	payload, err := computeReport(st, *country, *chart, *themePath, analysis.TrendConfig{
-		RankWeight:    *rankWeight,
-		ReviewWeight:  *reviewWeight,
-		NewEntryBonus: *newEntryBonus,
-	})
+	payload, err := computeReport(context.Background(), st, *country, chartKey, themeFile(*themePath), analysis.TrendConfig{
+		RankWeight:      *rankWeight,
+		ReviewWeight:    *reviewWeight,
+		NewEntryBonus:   *newEntryBonus,
+		RatingAvgWeight: *ratingAvgWeight,
+		LaunchWindow:    time.Duration(*launchDays) * 24 * time.Hour,
+		NormalizePerDay: *normalizePerDay,
+		WeightedThemes:  *weightedThemes,
+		ScoreMethod:     *scoreMethodFlag,
+		Reclassify:      *reclassify,
+	}, opts)
+	if code := noDataCode(err); code != "" {
+		slog.Warn("not enough data for a report", "country", *country, "chart", chartKey, "error", err)
+		return output.writeFile(*outPath, reportErrorPayload{
+			SchemaVersion: reportSchemaVersion,
+			GeneratedBy:   version.String,
+			Country:       *country,
+			Chart:         chartKey,
+			Error:         code,
+			Message:       err.Error(),
+		})
+	}
 	if err != nil {
 		return err
 	}
-
-	var out *os.File
-	if *outPath == "-" {
-		out = os.Stdout
-	} else {
-		if err := ensureDirForFile(*outPath); err != nil {
-			return err
-		}
-		file, err := os.Create(*outPath)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		out = file
+	if *humanize {
+		humanizeReport(&payload)
 	}
 
-	enc := json.NewEncoder(out)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(payload); err != nil {
-		return fmt.Errorf("encode report: %w", err)
-	}
-	return nil
+	return output.writeFile(*outPath, payload)
 }
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// jsonSchemaDialect is the JSON Schema draft the schema command emits.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaPayloads are the payloads described by the schema command and
+// /api/schema, with their schema_version.
+var schemaPayloads = []struct {
+	name    string
+	title   string
+	payload any
+	version int
+}{
+	{"report", "report-json and /api/report", reportPayload{}, reportSchemaVersion},
+	{"timeseries", "timeseries-json and /api/timeseries", timeSeriesPayload{}, timeSeriesSchemaVersion},
+}
+
+// payloadSchema returns the JSON Schema of one payload, or of all of them
+// under $defs when name is empty. It is generated from the payload structs,
+// so it cannot drift from what is actually encoded.
+func payloadSchema(name string) (map[string]any, error) {
+	defs := map[string]any{}
+	var refs []any
+	for _, p := range schemaPayloads {
+		if name != "" && name != p.name {
+			continue
+		}
+		schema := typeSchema(reflect.TypeOf(p.payload))
+		schema["title"] = p.title
+		// Pin schema_version so a validator rejects output of another
+		// version instead of half-matching it.
+		schema["properties"].(map[string]any)["schema_version"] = map[string]any{"const": p.version}
+		if name != "" {
+			schema["$schema"] = jsonSchemaDialect
+			return schema, nil
+		}
+		defs[p.name] = schema
+		refs = append(refs, map[string]any{"$ref": "#/$defs/" + p.name})
+	}
+	if name != "" {
+		return nil, fmt.Errorf("unknown payload %q (want %s)", name, schemaPayloadNames())
+	}
+	return map[string]any{
+		"$schema": jsonSchemaDialect,
+		"title":   "app_download_analyzer JSON payloads",
+		"$defs":   defs,
+		"anyOf":   refs,
+	}, nil
+}
+
+func schemaPayloadNames() string {
+	names := make([]string, len(schemaPayloads))
+	for i, p := range schemaPayloads {
+		names[i] = p.name
+	}
+	return strings.Join(names, ", ")
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// typeSchema describes how encoding/json encodes values of t. Nil pointers,
+// slices and maps encode as null, so those types admit null.
+func typeSchema(t reflect.Type) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	if t.Implements(marshalerType) {
+		// Custom encodings could be anything.
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(typeSchema(t.Elem()))
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return nullable(map[string]any{"type": "array", "items": typeSchema(t.Elem())})
+	case reflect.Map:
+		return nullable(map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())})
+	case reflect.Struct:
+		properties := map[string]any{}
+		required := []string{}
+		addStructFields(t, properties, &required)
+		sort.Strings(required)
+		return map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	}
+	return map[string]any{}
+}
+
+// addStructFields adds t's encoded fields, flattening embedded structs the
+// way encoding/json does. Fields tagged omitempty are not required.
+func addStructFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addStructFields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = typeSchema(field.Type)
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// nullable widens a schema with a single type to also accept null.
+func nullable(schema map[string]any) map[string]any {
+	if typ, ok := schema["type"].(string); ok {
+		schema["type"] = []string{typ, "null"}
+		return schema
+	}
+	return map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+}
+
+// runSchema prints the JSON Schema of the JSON payloads, so integrators can
+// validate against them or generate client types.
+func runSchema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	payload := fs.String("payload", "", "only describe this payload ("+schemaPayloadNames()+"); empty for all")
+	output := registerJSONFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	schema, err := payloadSchema(*payload)
+	if err != nil {
+		return err
+	}
+	return output.writeFile("-", schema)
+}
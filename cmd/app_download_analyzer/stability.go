@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"app_download_analyzer/internal/analysis"
+	"app_download_analyzer/internal/store"
+)
+
+func runStability(args []string) error {
+	fs := flag.NewFlagSet("stability", flag.ExitOnError)
+	country := fs.String("country", defaultCountry, "storefront country code")
+	chart := fs.String("chart", defaultChart, chartUsage)
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	last := fs.Int("last", 10, "show the most recent N snapshot pairs (0 for all)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	snapshots, err := st.ListSnapshots(*country, *chart)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) < 2 {
+		return fmt.Errorf("stability: %w", analysis.ErrInsufficientHistory)
+	}
+	start := 1
+	if *last > 0 && len(snapshots)-*last > start {
+		start = len(snapshots) - *last
+	}
+
+	prevItems, err := st.GetSnapshotItems(snapshots[start-1].ID)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Chart stability (Spearman rank correlation vs previous snapshot):")
+	for idx := start; idx < len(snapshots); idx++ {
+		items, err := st.GetSnapshotItems(snapshots[idx].ID)
+		if err != nil {
+			return err
+		}
+		rho, shared := analysis.RankCorrelation(prevItems, items)
+		fmt.Printf("  %s  %.2f  (%d shared apps)\n", snapshots[idx].CollectedAt.Format(time.RFC3339), rho, shared)
+		prevItems = items
+	}
+	return nil
+}
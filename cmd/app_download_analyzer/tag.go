@@ -0,0 +1,47 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+
+	"app_download_analyzer/internal/store"
+)
+
+// runTag labels a snapshot, e.g. to mark the baseline of an experiment, so
+// it can be found again with list --tag.
+func runTag(args []string) error {
+	fs := flag.NewFlagSet("tag", flag.ExitOnError)
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	id := fs.Int64("id", 0, "snapshot id (see list)")
+	tag := fs.String("set", "", "tag to give the snapshot, replacing any it has")
+	clear := fs.Bool("clear", false, "remove the snapshot's tag")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *id <= 0 {
+		return fmt.Errorf("--id is required")
+	}
+	if (*tag == "") == !*clear {
+		return fmt.Errorf("pass either --set TAG or --clear")
+	}
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	if err := st.SetSnapshotTag(*id, *tag); errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no snapshot with id %d", *id)
+	} else if err != nil {
+		return err
+	}
+	if *clear {
+		fmt.Printf("snapshot %d: tag cleared\n", *id)
+	} else {
+		fmt.Printf("snapshot %d: tagged %q\n", *id, *tag)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"app_download_analyzer/internal/analysis"
+)
+
+// themeSource supplies the theme config along with its raw content, which
+// fetches record next to each snapshot.
+type themeSource interface {
+	themeConfig() (analysis.ThemeConfig, []byte, error)
+}
+
+// themeFile reads the theme config from disk on every call, which suits
+// one-shot commands.
+type themeFile string
+
+func (f themeFile) themeConfig() (analysis.ThemeConfig, []byte, error) {
+	content, err := analysis.ReadThemeConfigContent(string(f))
+	if err != nil {
+		return analysis.ThemeConfig{}, nil, err
+	}
+	config, err := analysis.ParseThemeConfig(content)
+	if err != nil {
+		return analysis.ThemeConfig{}, nil, fmt.Errorf("theme config %s: %w", string(f), err)
+	}
+	return config, content, nil
+}
+
+// themeWatcher caches the theme config for serve and reloads it when the
+// file changes. A change that fails to parse is logged and the last good
+// config stays in use.
+type themeWatcher struct {
+	path string
+
+	mu      sync.RWMutex
+	config  analysis.ThemeConfig
+	content []byte
+	// modTime and size identify the version of the file last read, valid
+	// or not, so a broken edit is reported once rather than on every poll.
+	modTime time.Time
+	size    int64
+}
+
+// newThemeWatcher loads the config at path, failing if it is invalid.
+func newThemeWatcher(path string) (*themeWatcher, error) {
+	w := &themeWatcher{path: path}
+	if info, err := os.Stat(path); err == nil {
+		w.modTime, w.size = info.ModTime(), info.Size()
+	}
+	config, content, err := themeFile(path).themeConfig()
+	if err != nil {
+		return nil, err
+	}
+	w.config, w.content = config, content
+	return w, nil
+}
+
+func (w *themeWatcher) themeConfig() (analysis.ThemeConfig, []byte, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.config, w.content, nil
+}
+
+// watch polls the file every interval until ctx ends. Only watch calls
+// reload, so modTime and size need no locking.
+func (w *themeWatcher) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.reload()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reload re-reads the file if its modification time or size changed.
+func (w *themeWatcher) reload() {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		// Removed or unreadable: keep serving what was loaded, and warn
+		// once rather than on every poll.
+		if !w.modTime.IsZero() {
+			slog.Warn("theme config unavailable, keeping the loaded one", "path", w.path, "err", err)
+			w.modTime, w.size = time.Time{}, 0
+		}
+		return
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return
+	}
+	w.modTime, w.size = info.ModTime(), info.Size()
+
+	config, content, err := themeFile(w.path).themeConfig()
+	if err != nil {
+		slog.Error("theme config reload failed, keeping the previous one", "path", w.path, "err", err)
+		return
+	}
+	w.mu.Lock()
+	w.config, w.content = config, content
+	w.mu.Unlock()
+	slog.Info("theme config reloaded", "path", w.path, "rules", len(config.Rules))
+}
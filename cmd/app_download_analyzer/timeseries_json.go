@@ -1,46 +1,99 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"time"
 
 	"app_download_analyzer/internal/analysis"
+	"app_download_analyzer/internal/apple"
 	"app_download_analyzer/internal/store"
+	"app_download_analyzer/internal/version"
 )
 
 type timeSeriesMeta struct {
 	Country string `json:"country"`
 	Chart   string `json:"chart"`
+	Genre   string `json:"genre,omitempty"`
 	Limit   int    `json:"limit"`
+	// Timezone is the zone whose calendar groups the points.
+	Timezone string `json:"timezone"`
 }
 
+// timeSeriesSchemaVersion is timeSeriesPayload's schema_version. Bump it
+// whenever a field is renamed, removed or changes meaning.
+const timeSeriesSchemaVersion = 2
+
 type timeSeriesPayload struct {
-	Meta          timeSeriesMeta       `json:"meta"`
-	Dates         []string             `json:"dates"`
-	RotationIndex []float64            `json:"rotation_index"`
-	RiskOnScore   []float64            `json:"risk_on_score"`
-	RiskOffScore  []float64            `json:"risk_off_score"`
-	ThemeScores   map[string][]float64 `json:"theme_scores"`
-	TopApps       []timeSeriesTopApp   `json:"top_apps"`
+	SchemaVersion int            `json:"schema_version"`
+	GeneratedBy   string         `json:"generated_by"`
+	Meta          timeSeriesMeta `json:"meta"`
+	Dates         []string       `json:"dates"`
+	RotationIndex []float64      `json:"rotation_index"`
+	RiskOnScore   []float64      `json:"risk_on_score"`
+	RiskOffScore  []float64      `json:"risk_off_score"`
+	// Stability is analysis.RankCorrelation against the previous point,
+	// null for the first point and when fewer than two apps are shared.
+	Stability   []*float64           `json:"stability"`
+	Volatility  []float64            `json:"volatility"`
+	ThemeScores map[string][]float64 `json:"theme_scores"`
+	// ThemeScoresSmoothed is an EWMA of ThemeScores, set when smoothing is
+	// requested.
+	ThemeScoresSmoothed map[string][]float64 `json:"theme_scores_smoothed,omitempty"`
+	TopApps             []timeSeriesTopApp   `json:"top_apps"`
+	// RotationEvents are the dates where RotationIndex crossed zero or
+	// jumped, for annotating the chart.
+	RotationEvents []timeSeriesRotationEvent `json:"rotation_events"`
+	// RotationMAShort and RotationMALong are simple moving averages of
+	// RotationIndex, null until their window fills; RotationSignal is
+	// analysis.CrossoverSignals of the two.
+	RotationMAShort []*float64 `json:"rotation_ma_short"`
+	RotationMALong  []*float64 `json:"rotation_ma_long"`
+	RotationSignal  []string   `json:"rotation_signal"`
+	// RankThemes[d][r] is the theme of the app at rank r+1 on Dates[d], or
+	// "" when that rank was empty.
+	RankThemes [][]string `json:"rank_themes"`
+	// Tags[d] is the tag of the snapshot behind Dates[d], "" when untagged.
+	Tags []string `json:"tags"`
+}
+
+type timeSeriesRotationEvent struct {
+	Date string `json:"date"`
+	analysis.RotationEvent
 }
 
+// defaultRotationJump is the rotation index move between consecutive points
+// reported as a jump unless --rotation-threshold says otherwise.
+const defaultRotationJump = 0.5
+
+// Default moving average windows, in points, for the rotation crossover
+// signal.
+const (
+	defaultRotationMAShort = 3
+	defaultRotationMALong  = 7
+)
+
 type timeSeriesTopApp struct {
-	AppID        string `json:"app_id"`
-	AppName      string `json:"app_name"`
-	AppURL       string `json:"app_url"`
-	Ranks        []*int `json:"ranks"`
-	RatingCounts []*int `json:"rating_counts"`
+	AppID               string    `json:"app_id"`
+	AppName             string    `json:"app_name"`
+	AppURL              string    `json:"app_url"`
+	ArtworkURL          string    `json:"artwork_url"`
+	ArtworkURLLarge     string    `json:"artwork_url_large,omitempty"`
+	Ranks               []*int    `json:"ranks"`
+	RatingCounts        []*int    `json:"rating_counts"`
+	RatingCountsDisplay []*string `json:"rating_counts_display,omitempty"`
 }
 
 func runTimeSeriesJSON(args []string) error {
 	fs := flag.NewFlagSet("timeseries-json", flag.ExitOnError)
 	country := fs.String("country", defaultCountry, "storefront country code")
-	chart := fs.String("chart", defaultChart, "chart name (top-free, top-paid)")
+	chart := fs.String("chart", defaultChart, chartUsage)
 	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
 	themePath := fs.String("themes", "config/themes.json", "theme rules json")
 	outPath := fs.String("out", "timeseries.json", "output file path or '-' for stdout")
@@ -48,7 +101,41 @@ func runTimeSeriesJSON(args []string) error {
 	rankWeight := fs.Float64("rank-weight", 1.0, "weight for rank delta z-score")
 	reviewWeight := fs.Float64("review-weight", 1.0, "weight for review growth z-score")
 	newEntryBonus := fs.Float64("new-bonus", 0.5, "bonus for new chart entries")
-	if err := fs.Parse(args); err != nil {
+	ratingAvgWeight := fs.Float64("rating-avg-weight", 0, "weight for average rating delta (0 leaves it out of the score)")
+	humanize := fs.Bool("humanize-counts", false, "add abbreviated rating count display fields")
+	genre := fs.String("genre", "", "build the series from the chart fetched with this --genre id")
+	reclassify := fs.Bool("reclassify", false, "classify apps with the current theme config instead of the stored themes")
+	ewmaAlpha := fs.Float64("ewma-alpha", 0, "add EWMA-smoothed theme scores with this alpha in (0, 1] (0 disables)")
+	maShort := fs.Int("ma-short", defaultRotationMAShort, "points in the fast rotation index moving average")
+	maLong := fs.Int("ma-long", defaultRotationMALong, "points in the slow rotation index moving average")
+	rotationThreshold := fs.Float64("rotation-threshold", defaultRotationJump, "report rotation index moves larger than this as rotation_events (0 for zero crossings only)")
+	since := fs.String("since", "", "only snapshots collected at or after this time (RFC3339 or YYYY-MM-DD)")
+	until := fs.String("until", "", "only snapshots collected at or before this time (RFC3339 or YYYY-MM-DD, whole day)")
+	granularity := fs.String("granularity", periodDay, periodUsage)
+	tz := fs.String("tz", "", tzUsage)
+	output := registerJSONFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *ewmaAlpha < 0 || *ewmaAlpha > 1 {
+		return fmt.Errorf("--ewma-alpha must be in (0, 1], got %g", *ewmaAlpha)
+	}
+	if *maShort < 1 || *maLong <= *maShort {
+		return fmt.Errorf("need 1 <= --ma-short < --ma-long, got %d and %d", *maShort, *maLong)
+	}
+	if !validPeriod(*granularity) {
+		return fmt.Errorf("unsupported granularity: %s", *granularity)
+	}
+	loc, err := seriesLocation(*tz, *country)
+	if err != nil {
+		return err
+	}
+	sinceTime, untilTime, err := parseTimeRange(*since, *until, loc)
+	if err != nil {
+		return err
+	}
+	chartKey, err := chartKeyArg(*chart, *genre)
+	if err != nil {
 		return err
 	}
 
@@ -59,29 +146,69 @@ func runTimeSeriesJSON(args []string) error {
 	defer st.Close()
 
 	cfg := analysis.TrendConfig{
-		RankWeight:    *rankWeight,
-		ReviewWeight:  *reviewWeight,
-		NewEntryBonus: *newEntryBonus,
+		RankWeight:      *rankWeight,
+		ReviewWeight:    *reviewWeight,
+		NewEntryBonus:   *newEntryBonus,
+		RatingAvgWeight: *ratingAvgWeight,
+		Reclassify:      *reclassify,
 	}
 
-	payload, err := computeTimeSeries(st, *country, *chart, *themePath, cfg, *topN)
+	payload, err := computeTimeSeries(context.Background(), st, *country, chartKey, themeFile(*themePath), cfg, timeSeriesOptions{
+		TopN:        *topN,
+		Since:       sinceTime,
+		Until:       untilTime,
+		Granularity: *granularity,
+		Location:    loc,
+	})
 	if err != nil {
 		return err
 	}
+	if *ewmaAlpha > 0 {
+		smoothThemeScores(&payload, *ewmaAlpha)
+	}
+	payload.RotationEvents = rotationEvents(payload.Dates, payload.RotationIndex, *rotationThreshold)
+	applyRotationCrossover(&payload, *maShort, *maLong)
+	if *humanize {
+		humanizeTimeSeries(&payload)
+	}
+
+	return output.writeFile(*outPath, payload)
+}
 
-	return writeJSON(outPath, payload)
+// timeSeriesOptions selects the snapshots a time series covers and how
+// they are grouped into points.
+type timeSeriesOptions struct {
+	// TopN is the number of apps in top_apps.
+	TopN int
+	// Since and Until bound the collection time; zero leaves that end open.
+	Since, Until time.Time
+	// Granularity is the period one point covers (see periodDay); empty
+	// means periodDay.
+	Granularity string
+	// Location is the time zone periods follow; nil means the storefront's
+	// (see storefrontLocation).
+	Location *time.Location
 }
 
-func computeTimeSeries(st *store.Store, country, chart, themePath string, cfg analysis.TrendConfig, topN int) (timeSeriesPayload, error) {
-	snapshots, err := st.ListSnapshots(country, chart)
+// computeTimeSeries builds the series from the snapshots opts selects.
+func computeTimeSeries(ctx context.Context, st *store.Store, country, chart string, themes themeSource, cfg analysis.TrendConfig, opts timeSeriesOptions) (timeSeriesPayload, error) {
+	period := opts.Granularity
+	if period == "" {
+		period = periodDay
+	}
+	loc := opts.Location
+	if loc == nil {
+		loc = storefrontLocation(country)
+	}
+	snapshots, err := st.ListSnapshotsBetweenContext(ctx, country, chart, opts.Since, opts.Until)
 	if err != nil {
 		return timeSeriesPayload{}, err
 	}
 	if len(snapshots) == 0 {
-		return timeSeriesPayload{}, fmt.Errorf("no snapshots found")
+		return timeSeriesPayload{}, store.ErrNoSnapshots
 	}
 
-	themeConfig, err := analysis.LoadThemeConfig(themePath)
+	themeConfig, _, err := themes.themeConfig()
 	if err != nil {
 		return timeSeriesPayload{}, err
 	}
@@ -96,17 +223,22 @@ func computeTimeSeries(st *store.Store, country, chart, themePath string, cfg an
 	rotation := make([]float64, 0, len(snapshots))
 	riskOn := make([]float64, 0, len(snapshots))
 	riskOff := make([]float64, 0, len(snapshots))
+	stability := make([]*float64, 0, len(snapshots))
+	volatility := make([]float64, 0, len(snapshots))
+	rankThemes := make([][]string, 0, len(snapshots))
+	tags := make([]string, 0, len(snapshots))
+	classifier := analysis.NewThemeClassifier(themeConfig)
 
 	snapshotItems := make([][]store.ChartItem, 0, len(snapshots))
 	for _, snapshot := range snapshots {
-		items, err := st.GetSnapshotItems(snapshot.ID)
+		items, err := st.GetSnapshotItemsContext(ctx, snapshot.ID)
 		if err != nil {
 			return timeSeriesPayload{}, err
 		}
 		snapshotItems = append(snapshotItems, items)
 	}
 
-	snapshots, snapshotItems = groupSnapshotsByDate(snapshots, snapshotItems)
+	snapshots, snapshotItems = groupSnapshotsByPeriod(snapshots, snapshotItems, period, loc)
 
 	for idx, snapshot := range snapshots {
 		currentItems := snapshotItems[idx]
@@ -119,56 +251,220 @@ func computeTimeSeries(st *store.Store, country, chart, themePath string, cfg an
 
 		result := analysis.AnalyzeTrends(snapshot, prevSnapshot, currentItems, prevItems, cfg, themeConfig)
 
-		dates = append(dates, snapshot.CollectedAt.UTC().Format(time.RFC3339))
+		dates = append(dates, pointLabel(snapshot, period, loc))
+		tags = append(tags, snapshot.Tag)
 		rotation = append(rotation, result.RotationIndex)
 		riskOn = append(riskOn, result.RiskOnScore)
 		riskOff = append(riskOff, result.RiskOffScore)
+		var rhoPtr *float64
+		if idx > 0 {
+			if rho, shared := analysis.RankCorrelation(prevItems, currentItems); shared >= 2 {
+				rhoPtr = &rho
+			}
+		}
+		stability = append(stability, rhoPtr)
+		volatility = append(volatility, result.Volatility)
 
 		for _, theme := range themeNames {
 			themeScores[theme] = append(themeScores[theme], result.ThemeScores[theme])
 		}
+		rankThemes = append(rankThemes, themesByRank(classifier, snapshot, currentItems, cfg.Reclassify))
 	}
 
-	topApps := buildTopApps(snapshotItems, snapshots, topN)
+	topApps := buildTopApps(snapshotItems, snapshots, opts.TopN)
 
+	chartName, genre := store.SplitChartKey(chart)
 	payload := timeSeriesPayload{
+		SchemaVersion: timeSeriesSchemaVersion,
+		GeneratedBy:   version.String,
 		Meta: timeSeriesMeta{
-			Country: country,
-			Chart:   chart,
-			Limit:   snapshots[len(snapshots)-1].Limit,
+			Country:  country,
+			Chart:    chartName,
+			Genre:    genre,
+			Limit:    snapshots[len(snapshots)-1].Limit,
+			Timezone: loc.String(),
 		},
 		Dates:         dates,
 		RotationIndex: rotation,
 		RiskOnScore:   riskOn,
 		RiskOffScore:  riskOff,
+		Stability:     stability,
+		Volatility:    volatility,
 		ThemeScores:   themeScores,
 		TopApps:       topApps,
+		RankThemes:    rankThemes,
+		Tags:          tags,
 	}
+	payload.RotationEvents = rotationEvents(dates, rotation, defaultRotationJump)
+	applyRotationCrossover(&payload, defaultRotationMAShort, defaultRotationMALong)
 
 	return payload, nil
 }
 
-func groupSnapshotsByDate(snapshots []store.Snapshot, items [][]store.ChartItem) ([]store.Snapshot, [][]store.ChartItem) {
-	if len(snapshots) == 0 {
-		return snapshots, items
+// applyRotationCrossover sets the rotation index moving averages and the
+// crossover signal for the given windows.
+func applyRotationCrossover(payload *timeSeriesPayload, short, long int) {
+	fast := analysis.MovingAverage(payload.RotationIndex, short)
+	slow := analysis.MovingAverage(payload.RotationIndex, long)
+	payload.RotationMAShort = nullableSeries(fast)
+	payload.RotationMALong = nullableSeries(slow)
+	payload.RotationSignal = analysis.CrossoverSignals(fast, slow)
+}
+
+// nullableSeries maps NaN points to nil so they encode as JSON null.
+func nullableSeries(values []float64) []*float64 {
+	out := make([]*float64, len(values))
+	for i := range values {
+		if !math.IsNaN(values[i]) {
+			out[i] = &values[i]
+		}
 	}
-	loc, err := time.LoadLocation("Asia/Seoul")
-	if err != nil {
-		loc = time.UTC
+	return out
+}
+
+func rotationEvents(dates []string, rotation []float64, threshold float64) []timeSeriesRotationEvent {
+	events := []timeSeriesRotationEvent{}
+	for _, event := range analysis.DetectRotationShifts(rotation, threshold) {
+		events = append(events, timeSeriesRotationEvent{Date: dates[event.Index], RotationEvent: event})
 	}
+	return events
+}
 
-	dateIndex := make(map[string]int, len(snapshots))
+// themesByRank lists the theme at each rank of a snapshot, 1 through its
+// limit, leaving ranks without an item empty.
+func themesByRank(classifier *analysis.ThemeClassifier, snapshot store.Snapshot, items []store.ChartItem, reclassify bool) []string {
+	themes := make([]string, snapshot.Limit)
+	for _, item := range items {
+		if item.Rank < 1 {
+			continue
+		}
+		for len(themes) < item.Rank {
+			themes = append(themes, "")
+		}
+		themes[item.Rank-1] = classifier.ClassifyItem(item, reclassify)
+	}
+	return themes
+}
+
+func smoothThemeScores(payload *timeSeriesPayload, alpha float64) {
+	payload.ThemeScoresSmoothed = make(map[string][]float64, len(payload.ThemeScores))
+	for theme, scores := range payload.ThemeScores {
+		payload.ThemeScoresSmoothed[theme] = analysis.SmoothSeries(scores, alpha)
+	}
+}
+
+type timeSeriesMultiPayload struct {
+	Chart  string                       `json:"chart"`
+	Series map[string]timeSeriesPayload `json:"series"`
+	Errors map[string]string            `json:"errors,omitempty"`
+}
+
+// computeTimeSeriesMulti computes the time series for several countries using
+// a small worker pool. Countries that fail are reported in Errors rather than
+// failing the whole payload.
+func computeTimeSeriesMulti(ctx context.Context, st *store.Store, countries []string, chart string, themes themeSource, cfg analysis.TrendConfig, topN int) timeSeriesMultiPayload {
+	const workers = 4
+	type result struct {
+		country string
+		payload timeSeriesPayload
+		err     error
+	}
+
+	jobs := make(chan string)
+	results := make(chan result, len(countries))
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(countries); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for country := range jobs {
+				payload, err := computeTimeSeries(ctx, st, country, chart, themes, cfg, timeSeriesOptions{TopN: topN})
+				results <- result{country: country, payload: payload, err: err}
+			}
+		}()
+	}
+	for _, country := range countries {
+		jobs <- country
+	}
+	close(jobs)
+	wg.Wait()
+	close(results)
+
+	out := timeSeriesMultiPayload{
+		Chart:  chart,
+		Series: make(map[string]timeSeriesPayload, len(countries)),
+	}
+	for res := range results {
+		if res.err != nil {
+			if out.Errors == nil {
+				out.Errors = map[string]string{}
+			}
+			out.Errors[res.country] = res.err.Error()
+			continue
+		}
+		out.Series[res.country] = res.payload
+	}
+	return out
+}
+
+// Time series granularities: the calendar period whose snapshots one point
+// stands for, or periodRaw for a point per snapshot.
+const (
+	periodRaw   = "raw"
+	periodDay   = "day"
+	periodWeek  = "week"
+	periodMonth = "month"
+)
+
+const periodUsage = "period one point covers (day, week, month), or raw for every snapshot"
+
+func validPeriod(period string) bool {
+	return period == periodRaw || period == periodDay || period == periodWeek || period == periodMonth
+}
+
+// periodKey names the period of the given granularity that t falls in, in
+// loc: 2024-01-15, the ISO week 2024-W03, or 2024-01.
+func periodKey(t time.Time, period string, loc *time.Location) string {
+	t = t.In(loc)
+	switch period {
+	case periodWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case periodMonth:
+		return t.Format("2006-01")
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+// pointLabel is a point's entry in dates: the snapshot's collection time for
+// daily and raw points, which consumers already parse as RFC3339, and the
+// period key for coarser ones.
+func pointLabel(snapshot store.Snapshot, period string, loc *time.Location) string {
+	if period == periodDay || period == periodRaw {
+		return snapshot.CollectedAt.UTC().Format(time.RFC3339)
+	}
+	return periodKey(snapshot.DataTime(), period, loc)
+}
+
+// groupSnapshotsByPeriod keeps the last snapshot of each period, so every
+// point is the chart as it stood at the end of its day, week or month in loc.
+// With periodRaw it keeps every snapshot.
+func groupSnapshotsByPeriod(snapshots []store.Snapshot, items [][]store.ChartItem, period string, loc *time.Location) ([]store.Snapshot, [][]store.ChartItem) {
+	if len(snapshots) == 0 || period == periodRaw {
+		return snapshots, items
+	}
+	lastIndex := make(map[string]int, len(snapshots))
 	for i, snapshot := range snapshots {
-		key := snapshot.CollectedAt.In(loc).Format("2006-01-02")
-		dateIndex[key] = i
+		lastIndex[periodKey(snapshot.DataTime(), period, loc)] = i
 	}
 
-	seen := make(map[string]bool, len(dateIndex))
-	groupedSnapshots := make([]store.Snapshot, 0, len(dateIndex))
-	groupedItems := make([][]store.ChartItem, 0, len(dateIndex))
+	seen := make(map[string]bool, len(lastIndex))
+	groupedSnapshots := make([]store.Snapshot, 0, len(lastIndex))
+	groupedItems := make([][]store.ChartItem, 0, len(lastIndex))
 	for i, snapshot := range snapshots {
-		key := snapshot.CollectedAt.In(loc).Format("2006-01-02")
-		if dateIndex[key] != i || seen[key] {
+		key := periodKey(snapshot.DataTime(), period, loc)
+		if lastIndex[key] != i || seen[key] {
 			continue
 		}
 		seen[key] = true
@@ -210,9 +506,11 @@ func buildTopApps(snapshotItems [][]store.ChartItem, snapshots []store.Snapshot,
 	for i := 0; i < topN; i++ {
 		item := latestItems[i]
 		topApps = append(topApps, timeSeriesTopApp{
-			AppID:   item.AppID,
-			AppName: item.AppName,
-			AppURL:  item.AppURL,
+			AppID:           item.AppID,
+			AppName:         item.AppName,
+			AppURL:          item.AppURL,
+			ArtworkURL:      item.ArtworkURL,
+			ArtworkURLLarge: apple.ArtworkURL(item.ArtworkURL, largeArtworkSize),
 		})
 	}
 
@@ -235,39 +533,12 @@ func buildTopApps(snapshotItems [][]store.ChartItem, snapshots []store.Snapshot,
 			}
 			rank := item.Rank
 			topApps[idx].Ranks[snapIdx] = &rank
-			if item.RatingCount.Valid {
-				count := item.RatingCount.Value
-				topApps[idx].RatingCounts[snapIdx] = &count
-			}
+			topApps[idx].RatingCounts[snapIdx] = item.RatingCount.Ptr()
 		}
 	}
 	return topApps
 }
 
-func writeJSON(path *string, payload any) error {
-	var out *os.File
-	if *path == "-" {
-		out = os.Stdout
-	} else {
-		if err := ensureDirForFile(*path); err != nil {
-			return err
-		}
-		file, err := os.Create(*path)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		out = file
-	}
-
-	enc := json.NewEncoder(out)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(payload); err != nil {
-		return fmt.Errorf("encode json: %w", err)
-	}
-	return nil
-}
-
 func ensureDirForFile(path string) error {
 	dir := filepath.Dir(path)
 	if dir == "." || dir == "" {
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	// Embedded so day boundaries do not depend on the host having tzdata;
+	// without it time.LoadLocation fails on minimal images.
+	_ "time/tzdata"
+)
+
+// storefrontZones is the time zone whose calendar day a storefront's charts
+// are read in. Storefronts spanning several zones use their most populous
+// one; storefronts not listed use UTC.
+var storefrontZones = map[string]string{
+	"kr": "Asia/Seoul",
+	"jp": "Asia/Tokyo",
+	"cn": "Asia/Shanghai",
+	"tw": "Asia/Taipei",
+	"hk": "Asia/Hong_Kong",
+	"sg": "Asia/Singapore",
+	"in": "Asia/Kolkata",
+	"au": "Australia/Sydney",
+	"us": "America/New_York",
+	"ca": "America/Toronto",
+	"br": "America/Sao_Paulo",
+	"mx": "America/Mexico_City",
+	"gb": "Europe/London",
+	"de": "Europe/Berlin",
+	"fr": "Europe/Paris",
+	"es": "Europe/Madrid",
+	"it": "Europe/Rome",
+	"nl": "Europe/Amsterdam",
+}
+
+// tzUsage describes the --tz flag and the ?tz= query parameter.
+const tzUsage = "IANA time zone whose days, weeks and months group snapshots and bare dates are read in (default: the storefront's own, else UTC)"
+
+// tzDateUsage describes --tz on commands that only take dates.
+const tzDateUsage = "IANA time zone YYYY-MM-DD arguments are read in (default: the storefront's own, else UTC)"
+
+// storefrontLocation is the default series time zone for a storefront.
+func storefrontLocation(country string) *time.Location {
+	name, ok := storefrontZones[strings.ToLower(country)]
+	if !ok {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// seriesLocation resolves a --tz value for a storefront: the named zone, or
+// the storefront's default when name is empty.
+func seriesLocation(name, country string) (*time.Location, error) {
+	if name == "" {
+		return storefrontLocation(country), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	return loc, nil
+}
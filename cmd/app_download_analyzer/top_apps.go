@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"app_download_analyzer/internal/analysis"
+	"app_download_analyzer/internal/store"
+)
+
+type topAppsPayload struct {
+	Snapshot reportSnapshot `json:"snapshot"`
+	Apps     []topAppEntry  `json:"apps"`
+}
+
+type topAppEntry struct {
+	Rank        int    `json:"rank"`
+	AppID       string `json:"app_id"`
+	AppName     string `json:"app_name"`
+	Theme       string `json:"theme"`
+	RatingCount *int   `json:"rating_count"`
+}
+
+// runTopApps prints the latest snapshot's chart as stored. Unlike report it
+// needs only one snapshot, so it works right after the first fetch.
+func runTopApps(args []string) error {
+	fs := flag.NewFlagSet("top-apps", flag.ExitOnError)
+	country := fs.String("country", defaultCountry, "storefront country code")
+	chart := fs.String("chart", defaultChart, chartUsage)
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	themePath := fs.String("themes", "config/themes.json", "theme rules json for items stored without a theme")
+	topN := fs.Int("top", 25, "number of apps to list (0 for all)")
+	reclassify := fs.Bool("reclassify", false, "classify apps with the current theme config instead of the stored themes")
+	asJSON := fs.Bool("json", false, "emit the chart as JSON")
+	output := registerJSONFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	themeConfig, err := analysis.LoadThemeConfig(*themePath)
+	if err != nil {
+		return err
+	}
+	classifier := analysis.NewThemeClassifier(themeConfig)
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	latest, err := st.GetLatestSnapshot(*country, *chart)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no snapshots for %s/%s; run fetch first", *country, *chart)
+	}
+	if err != nil {
+		return err
+	}
+	items, err := st.GetSnapshotItems(latest.ID)
+	if err != nil {
+		return err
+	}
+	if *topN > 0 && *topN < len(items) {
+		items = items[:*topN]
+	}
+
+	payload := topAppsPayload{
+		Snapshot: newReportSnapshot(latest),
+		Apps:     make([]topAppEntry, 0, len(items)),
+	}
+	for _, item := range items {
+		entry := topAppEntry{
+			Rank:        item.Rank,
+			AppID:       item.AppID,
+			AppName:     item.AppName,
+			Theme:       classifier.ClassifyItem(item, *reclassify),
+			RatingCount: item.RatingCount.Ptr(),
+		}
+		payload.Apps = append(payload.Apps, entry)
+	}
+
+	if *asJSON {
+		return output.writeFile("-", payload)
+	}
+	fmt.Printf("Latest snapshot: %s (%s %s)\n", latest.CollectedAt.Format(time.RFC3339), latest.Country, latest.ChartKey())
+	fmt.Println()
+	for _, entry := range payload.Apps {
+		ratings := "n/a"
+		if entry.RatingCount != nil {
+			ratings = fmt.Sprint(*entry.RatingCount)
+		}
+		fmt.Printf("%3d. %s (%s) ratings %s\n", entry.Rank, entry.AppName, entry.Theme, ratings)
+	}
+	return nil
+}
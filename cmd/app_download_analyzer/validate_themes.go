@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"app_download_analyzer/internal/analysis"
+)
+
+// runValidateThemes checks a theme config before it is deployed, since a
+// bad rule otherwise only shows up as apps landing in the wrong theme.
+func runValidateThemes(args []string) error {
+	fs := flag.NewFlagSet("validate-themes", flag.ExitOnError)
+	themePath := fs.String("themes", "config/themes.json", "theme rules json to check")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Other commands fall back to the built-in themes when the file is
+	// missing; here that would hide a wrong path.
+	data, err := os.ReadFile(*themePath)
+	if err != nil {
+		return err
+	}
+	// A misspelled key such as "risk-on" would otherwise be dropped without
+	// a word.
+	var cfg analysis.ThemeConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return fmt.Errorf("%s: %w", *themePath, err)
+	}
+
+	issues := analysis.ValidateThemeConfig(cfg)
+	themes := map[string]bool{}
+	for _, rule := range cfg.Rules {
+		if theme := strings.ToLower(strings.TrimSpace(rule.Theme)); theme != "" {
+			themes[theme] = true
+		}
+	}
+	fmt.Printf("%s: %d rules, %d themes, %d ignore patterns, %d indexes\n",
+		*themePath, len(cfg.Rules), len(themes), len(cfg.IgnorePatterns), len(cfg.Indexes))
+	fmt.Printf("  risk_on:  %s\n", strings.Join(cfg.RiskOn, ", "))
+	fmt.Printf("  risk_off: %s\n", strings.Join(cfg.RiskOff, ", "))
+
+	errorCount := 0
+	for _, issue := range issues {
+		if !issue.Warning {
+			errorCount++
+		}
+		fmt.Println(issue)
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("%s: %d errors, %d warnings", *themePath, errorCount, len(issues)-errorCount)
+	}
+	if len(issues) > 0 {
+		fmt.Printf("ok, %d warnings\n", len(issues))
+	} else {
+		fmt.Println("ok")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"app_download_analyzer/internal/store"
+)
+
+// runVerify reports snapshots whose stored items fall short of what their
+// fetch stored, and with --fix --yes deletes the partial ones.
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	country := fs.String("country", "", "storefront country code (empty for all)")
+	chart := fs.String("chart", "", "chart name (empty for all)")
+	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
+	fix := fs.Bool("fix", false, "list the partial snapshots that would be deleted")
+	yes := fs.Bool("yes", false, "with --fix, actually delete them")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *yes && !*fix {
+		return fmt.Errorf("--yes only applies with --fix")
+	}
+
+	st, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	results, err := st.SnapshotIntegrity(*country, *chart)
+	if err != nil {
+		return err
+	}
+	var problems, unchecked, partial int
+	for _, result := range results {
+		if !result.Checked() {
+			unchecked++
+		}
+		if result.OK() {
+			continue
+		}
+		problems++
+		fmt.Printf("snapshot %d (%s %s/%s): %s\n", result.ID, result.CollectedAt.Format(time.RFC3339),
+			result.Country, result.ChartKey(), integrityProblem(result))
+		if !*fix || !result.Partial() {
+			continue
+		}
+		partial++
+		if *yes {
+			if err := st.DeleteSnapshot(result.ID); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Printf("checked %d snapshots, %d with problems\n", len(results), problems)
+	if unchecked > 0 {
+		fmt.Printf("%d snapshots predate the expected item count and were only checked for being empty\n", unchecked)
+	}
+	switch {
+	case *yes:
+		fmt.Printf("deleted %d partial snapshots\n", partial)
+	case *fix:
+		fmt.Printf("would delete %d partial snapshots; rerun with --fix --yes to delete them\n", partial)
+	}
+	return nil
+}
+
+func integrityProblem(result store.SnapshotIntegrity) string {
+	if !result.Checked() {
+		return "no items"
+	}
+	problem := fmt.Sprintf("%d of %d items", result.ItemCount, result.ExpectedItems.Value)
+	if result.Partial() {
+		problem += ", partial"
+	}
+	return problem
+}
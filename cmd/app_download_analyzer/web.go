@@ -2,15 +2,24 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	_ "embed"
-	"encoding/json"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"app_download_analyzer/internal/analysis"
+	"app_download_analyzer/internal/apple"
 	"app_download_analyzer/internal/store"
 )
 
@@ -20,20 +29,51 @@ var indexHTML string
 func runServe(args []string) error {
 	fs := flag.NewFlagSet("serve", flag.ExitOnError)
 	country := fs.String("country", defaultCountry, "storefront country code")
-	chart := fs.String("chart", defaultChart, "chart name (top-free, top-paid)")
+	chart := fs.String("chart", defaultChart, chartUsage)
 	dbPath := fs.String("db", defaultDBPath, "sqlite db path")
 	themePath := fs.String("themes", "config/themes.json", "theme rules json")
+	themesPoll := fs.Duration("themes-poll", 5*time.Second, "how often to check the theme config for changes (0 disables reloading)")
 	addr := fs.String("addr", ":8080", "http listen address")
+	readTimeout := fs.Duration("read-timeout", 15*time.Second, "max time to read a request, body included")
+	writeTimeout := fs.Duration("write-timeout", 30*time.Second, "max time to write a response (not applied to /api/events or POST /api/fetch)")
 	limit := fs.Int("limit", defaultLimit, "chart size (25 or 50 recommended)")
 	autoFetch := fs.Bool("auto-fetch", true, "enable periodic snapshot fetch")
 	fetchOnStart := fs.Bool("fetch-on-start", true, "fetch snapshot immediately on startup")
 	interval := fs.Duration("interval", 6*time.Hour, "auto fetch interval")
 	noItunes := fs.Bool("no-itunes", false, "skip iTunes lookup enrichment")
+	deferEnrich := fs.Bool("defer-enrich", false, "store the chart first, then run iTunes enrichment without holding the lock")
 	timeout := fs.Duration("timeout", 20*time.Second, "http timeout")
+	itunesConcurrency := fs.Int("itunes-concurrency", 4, "iTunes lookup requests to run at once")
+	itunesRate := fs.Int("itunes-rate", apple.DefaultLookupsPerMinute, "max iTunes lookup requests per minute (0 for no limit)")
+	itunesDelay := fs.Duration("itunes-delay", 150*time.Millisecond, "pause between iTunes lookup requests of one chart")
+	itunesLang := fs.String("itunes-lang", "", "language for iTunes lookup results, e.g. en_us (empty for the storefront default)")
 	rankWeight := fs.Float64("rank-weight", 1.0, "weight for rank delta z-score")
 	reviewWeight := fs.Float64("review-weight", 1.0, "weight for review growth z-score")
 	newEntryBonus := fs.Float64("new-bonus", 0.5, "bonus for new chart entries")
-	if err := fs.Parse(args); err != nil {
+	ratingAvgWeight := fs.Float64("rating-avg-weight", 0, "weight for average rating delta (0 leaves it out of the score)")
+	normalizePerDay := fs.Bool("normalize-per-day", false, "add each app's rating growth per day between snapshots (display only)")
+	weightedThemes := fs.Bool("weighted-themes", false, "spread apps across all matching themes when scoring momentum")
+	scoreMethodFlag := fs.String("score-method", analysis.ScoreZScore, "delta scoring (zscore, percentile)")
+	reclassify := fs.Bool("reclassify", false, "classify apps with the current theme config instead of the stored themes")
+	metricsEnabled := fs.Bool("metrics", true, "expose Prometheus metrics at /metrics")
+	key := fs.String("api-key", "", "require this key in the X-API-Key header (or ?key=) on /api/* requests")
+	allowManualFetch := fs.Bool("allow-manual-fetch", false, "enable POST /api/fetch to fetch the served chart on demand")
+	noStore := fs.Bool("no-store", false, "send Cache-Control: no-store on /api/report instead of an ETag and max-age")
+	reportMaxAge := fs.Duration("report-max-age", time.Minute, "how long clients may reuse an /api/report response without revalidating")
+	output := registerJSONFlags(fs)
+	var cors corsOrigins
+	fs.Var(&cors, "cors-origin", "origin allowed to call /api/* from a browser (repeatable or comma-separated; * for any)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if !analysis.ValidScoreMethod(*scoreMethodFlag) {
+		return fmt.Errorf("unsupported score method: %s", *scoreMethodFlag)
+	}
+
+	// Load the theme config once; a broken file fails startup here rather
+	// than on the first request.
+	themes, err := newThemeWatcher(*themePath)
+	if err != nil {
 		return err
 	}
 
@@ -43,13 +83,35 @@ func runServe(args []string) error {
 	}
 	defer st.Close()
 
-	client := &http.Client{Timeout: *timeout}
-	var mu sync.Mutex
+	client := newAppleClient(*timeout, *itunesConcurrency, *itunesRate, *itunesDelay, *itunesLang)
+	// ctx ends on SIGINT or SIGTERM, stopping the fetch loop and the server.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *themesPoll > 0 {
+		go themes.watch(ctx, *themesPoll)
+	}
+	// The store lets reads run alongside a write, so handlers take no lock;
+	// fetchMu only keeps a manual fetch from interleaving with a scheduled
+	// one, which could store the same chart twice.
+	var fetchMu sync.Mutex
+	// enriching is the id of the snapshot whose deferred enrichment is
+	// running, 0 when none is; /api/report keeps to the snapshot before it.
+	var enriching atomic.Int64
+	events := newEventBroker()
+	fetches := &fetchTracker{}
+	metrics := &serverMetrics{}
+	auth := apiKey(*key)
+	reports := newReportCache(*noStore, *reportMaxAge)
 
 	cfg := analysis.TrendConfig{
-		RankWeight:    *rankWeight,
-		ReviewWeight:  *reviewWeight,
-		NewEntryBonus: *newEntryBonus,
+		RankWeight:      *rankWeight,
+		ReviewWeight:    *reviewWeight,
+		NewEntryBonus:   *newEntryBonus,
+		RatingAvgWeight: *ratingAvgWeight,
+		NormalizePerDay: *normalizePerDay,
+		WeightedThemes:  *weightedThemes,
+		ScoreMethod:     *scoreMethodFlag,
+		Reclassify:      *reclassify,
 	}
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -61,67 +123,446 @@ func runServe(args []string) error {
 		_, _ = w.Write([]byte(indexHTML))
 	})
 
-	http.HandleFunc("/api/report", func(w http.ResponseWriter, r *http.Request) {
-		mu.Lock()
-		defer mu.Unlock()
-		payload, err := computeReport(st, *country, *chart, *themePath, cfg)
+	http.HandleFunc("/api/report", cors.wrap(auth.wrap(gzipHandler(func(w http.ResponseWriter, r *http.Request) {
+		reqCountry, reqChart, ok := chartParams(w, r, *country, *chart)
+		if !ok {
+			return
+		}
+		var opts reportOptions
+		if asOf := r.URL.Query().Get("as_of"); asOf != "" {
+			loc, err := seriesLocation(r.URL.Query().Get("tz"), reqCountry)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if opts.AsOf, err = parseEndTimeArg(asOf, loc); err != nil {
+				http.Error(w, "invalid as_of: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		opts.Pending = enriching.Load()
+		// Checking the ETag costs a few indexed lookups; a miss, or no data
+		// yet, falls through to computeReport.
+		if latest, err := reportTarget(r.Context(), st, reqCountry, reqChart, opts); err == nil {
+			if _, themeContent, err := themes.themeConfig(); err == nil {
+				if etag, err := reports.etag(r.Context(), st, latest, themeContent); err == nil && reports.check(w, r, etag) {
+					return
+				}
+			}
+		}
+		payload, err := computeReport(r.Context(), st, reqCountry, reqChart, themes, cfg, opts)
 		if err != nil {
+			w.Header().Del("ETag")
+			w.Header().Del("Cache-Control")
 			http.Error(w, err.Error(), http.StatusServiceUnavailable)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Cache-Control", "no-store")
-		enc := json.NewEncoder(w)
-		enc.SetIndent("", "  ")
-		if err := enc.Encode(payload); err != nil {
-			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		output.serve(w, payload)
+	}))))
+
+	http.HandleFunc("/api/timeseries", cors.wrap(auth.wrap(gzipHandler(func(w http.ResponseWriter, r *http.Request) {
+		reqCountry, reqChart, ok := chartParams(w, r, *country, *chart)
+		if !ok {
+			return
+		}
+		granularity := r.URL.Query().Get("granularity")
+		if granularity != "" && !validPeriod(granularity) {
+			http.Error(w, "unsupported granularity: "+granularity, http.StatusBadRequest)
 			return
 		}
-	})
-
-	http.HandleFunc("/api/timeseries", func(w http.ResponseWriter, r *http.Request) {
-		mu.Lock()
-		defer mu.Unlock()
-		payload, err := computeTimeSeries(st, *country, *chart, *themePath, cfg, *limit)
+		loc, err := seriesLocation(r.URL.Query().Get("tz"), reqCountry)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		payload, err := computeTimeSeries(r.Context(), st, reqCountry, reqChart, themes, cfg, timeSeriesOptions{TopN: *limit, Granularity: granularity, Location: loc})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusServiceUnavailable)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Cache-Control", "no-store")
-		enc := json.NewEncoder(w)
-		enc.SetIndent("", "  ")
-		if err := enc.Encode(payload); err != nil {
-			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		output.serve(w, payload)
+	}))))
+
+	http.HandleFunc("/api/snapshots", cors.wrap(auth.wrap(gzipHandler(func(w http.ResponseWriter, r *http.Request) {
+		reqCountry, reqChart, ok := chartParams(w, r, *country, *chart)
+		if !ok {
+			return
+		}
+		limit, offset, ok := pageParams(w, r)
+		if !ok {
 			return
 		}
-	})
+		summaries, total, err := st.ListSnapshotSummariesPagedContext(r.Context(), reqCountry, reqChart, limit, offset)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(totalCountHeader, strconv.Itoa(total))
+		output.serve(w, snapshotListEntries(summaries))
+	}))))
 
-	if *autoFetch {
-		go func() {
-			doFetch := func() {
-				mu.Lock()
-				defer mu.Unlock()
-				ctx := context.Background()
-				snapshotID, count, err := fetchSnapshot(ctx, client, st, *country, *chart, *limit, *noItunes)
-				if err != nil {
-					log.Printf("auto fetch failed: %v", err)
-					return
-				}
-				log.Printf("auto snapshot %d (%s/%s, %d items)", snapshotID, *country, *chart, count)
+	http.HandleFunc("/api/snapshot-items", cors.wrap(auth.wrap(gzipHandler(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id must be a snapshot id", http.StatusBadRequest)
+			return
+		}
+		limit, offset, ok := pageParams(w, r)
+		if !ok {
+			return
+		}
+		themeConfig, _, err := themes.themeConfig()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		classifier := analysis.NewThemeClassifier(themeConfig)
+		if _, err := st.GetSnapshotByIDContext(r.Context(), id); errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "snapshot not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		items, total, err := st.GetSnapshotItemsPagedContext(r.Context(), id, limit, offset)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entries := make([]topAppEntry, 0, len(items))
+		for _, item := range items {
+			entries = append(entries, topAppEntry{
+				Rank:        item.Rank,
+				AppID:       item.AppID,
+				AppName:     item.AppName,
+				Theme:       classifier.ClassifyItem(item, cfg.Reclassify),
+				RatingCount: item.RatingCount.Ptr(),
+			})
+		}
+		w.Header().Set(totalCountHeader, strconv.Itoa(total))
+		output.serve(w, entries)
+	}))))
+
+	http.HandleFunc("/api/app", cors.wrap(auth.wrap(gzipHandler(func(w http.ResponseWriter, r *http.Request) {
+		appID := strings.TrimSpace(r.URL.Query().Get("id"))
+		if appID == "" {
+			http.Error(w, "id query parameter is required", http.StatusBadRequest)
+			return
+		}
+		reqCountry, reqChart, ok := chartParams(w, r, *country, *chart)
+		if !ok {
+			return
+		}
+		points, err := st.GetAppHistoryContext(r.Context(), reqCountry, reqChart, appID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload, found := newAppHistoryPayload(reqCountry, reqChart, appID, points)
+		if !found {
+			http.Error(w, "app not found in any snapshot", http.StatusNotFound)
+			return
+		}
+		output.serve(w, payload)
+	}))))
+
+	http.HandleFunc("/api/timeseries-multi", cors.wrap(auth.wrap(gzipHandler(func(w http.ResponseWriter, r *http.Request) {
+		countries, ok := countriesParam(w, r)
+		if !ok {
+			return
+		}
+		seriesChart, ok := chartKeyParam(w, r, *chart)
+		if !ok {
+			return
+		}
+		payload := computeTimeSeriesMulti(r.Context(), st, countries, seriesChart, themes, cfg, *limit)
+		output.serve(w, payload)
+	}))))
+
+	http.HandleFunc("/api/schema", cors.wrap(auth.wrap(gzipHandler(func(w http.ResponseWriter, r *http.Request) {
+		schema, err := payloadSchema(r.URL.Query().Get("payload"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		output.serve(w, schema)
+	}))))
+
+	http.HandleFunc("/api/events", cors.wrap(auth.wrap(events.ServeHTTP)))
+	registerHealthHandlers(st, *country, *chart, fetches, *output)
+	if *metricsEnabled {
+		http.Handle("/metrics", metrics.handler(st, *country, *chart, fetches))
+	}
+
+	// doFetch fetches the served chart, making up to attempts tries with a
+	// growing delay between them; trigger ("auto" or "manual") only labels
+	// the log lines. Cancelling ctx also ends a wait between tries.
+	doFetch := func(ctx context.Context, trigger string, attempts int) (fetchEvent, error) {
+		fetches.begin(time.Now().UTC())
+		// A fetch, including its retries and database writes, must not
+		// outlive the interval, or runs would pile up behind the lock.
+		ctx, cancel := context.WithTimeout(ctx, *interval)
+		defer cancel()
+		var fetched fetchedSnapshot
+		var err error
+		for attempt := 1; ; attempt++ {
+			fetchMu.Lock()
+			fetched, err = fetchSnapshot(ctx, client, st, *country, *chart, *limit, *noItunes || *deferEnrich, false, themes, nil)
+			fetchMu.Unlock()
+			// A missing feed means a bad country or chart; retrying won't help.
+			if err == nil || attempt >= attempts || errors.Is(err, apple.ErrFeedNotFound) {
+				break
+			}
+			delay := fetchRetryDelay << (attempt - 1)
+			slog.Warn("fetch attempt failed, retrying", "trigger", trigger, "attempt", attempt, "attempts", attempts, "err", err, "retry_in", delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		snapshotID, count := fetched.SnapshotID, fetched.Count
+		if fetched.Duplicate {
+			metrics.recordFetch(0, err)
+		} else {
+			metrics.recordFetch(count, err)
+		}
+		if err != nil {
+			slog.Error("fetch failed", "trigger", trigger, "err", err)
+			fetches.fail(err)
+			return fetchEvent{}, err
+		}
+		fetches.record(time.Now().UTC())
+		event := fetchEvent{
+			SnapshotID:  snapshotID,
+			Count:       count,
+			Country:     *country,
+			Chart:       *chart,
+			CollectedAt: time.Now().UTC(),
+			Duplicate:   fetched.Duplicate,
+		}
+		if fetched.Duplicate {
+			// Nothing new was stored, so there is nothing to announce or
+			// enrich.
+			return event, nil
+		}
+		slog.Info("fetched snapshot", "trigger", trigger, "snapshot_id", snapshotID, "country", *country, "chart", *chart, "items", count)
+		if *deferEnrich && !*noItunes {
+			// Hold the report and the event back until the snapshot has
+			// its iTunes genres, or themes would be scored without them.
+			enriching.Store(snapshotID)
+			enriched, err := enrichSnapshot(ctx, client, st, snapshotID, *country, nil)
+			enriching.Store(0)
+			if err != nil {
+				slog.Error("enrich failed", "trigger", trigger, "snapshot_id", snapshotID, "err", err)
+			} else {
+				slog.Info("enriched snapshot", "trigger", trigger, "snapshot_id", snapshotID, "enriched", enriched, "items", count)
 			}
+		}
+		events.publish(event)
+		return event, nil
+	}
 
-			if *fetchOnStart {
-				doFetch()
+	if *allowManualFetch {
+		http.HandleFunc("/api/fetch", cors.wrap(auth.wrap(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			if wait, ok := fetches.beginUnlessWithin(time.Now().UTC(), manualFetchGap); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+				http.Error(w, "a fetch ran less than a minute ago", http.StatusTooManyRequests)
+				return
+			}
+			// A fetch with iTunes lookups can outlast the write timeout; the
+			// Apple client's own timeouts bound it instead.
+			_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+			event, err := doFetch(ctx, "manual", 1)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
 			}
+			output.serve(w, event)
+		})))
+	}
+
+	// Run the first fetch before binding so a mistyped country or chart
+	// fails at launch instead of serving a permanently empty dashboard. It
+	// is not retried, so a transient outage doesn't hold up binding.
+	if *autoFetch && *fetchOnStart {
+		if _, err := doFetch(ctx, "auto", 1); err != nil && errors.Is(err, apple.ErrFeedNotFound) {
+			return fmt.Errorf("no chart feed for %s/%s, check --country and --chart: %w", *country, *chart, err)
+		}
+	}
+	latest, err := st.GetLatestSnapshot(*country, *chart)
+	switch {
+	case err == nil:
+		slog.Info("data ready", "country", *country, "chart", *chart, "snapshot_id", latest.ID, "collected_at", latest.CollectedAt.Format(time.RFC3339))
+	case errors.Is(err, sql.ErrNoRows):
+		slog.Warn("no snapshots yet; /api/report returns 503 until a fetch succeeds", "country", *country, "chart", *chart)
+	default:
+		return err
+	}
+
+	if *autoFetch {
+		go func() {
 			ticker := time.NewTicker(*interval)
 			defer ticker.Stop()
-			for range ticker.C {
-				doFetch()
+			for {
+				select {
+				case <-ticker.C:
+					_, _ = doFetch(ctx, "auto", fetchAttempts)
+				case <-ctx.Done():
+					return
+				}
 			}
 		}()
 	}
 
-	log.Printf("serving report at http://localhost%s", *addr)
-	return http.ListenAndServe(*addr, nil)
+	server := &http.Server{
+		Addr:         *addr,
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  serverIdleTimeout,
+	}
+	server.RegisterOnShutdown(events.close)
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		slog.Info("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("shutdown failed", "err", err)
+		}
+	}()
+
+	slog.Info("serving report", "url", "http://localhost"+*addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	// ListenAndServe returns as soon as shutdown starts; wait for in-flight
+	// requests before closing the store.
+	<-shutdownDone
+	return nil
+}
+
+// manualFetchGap is the minimum time between the start of any fetch and a
+// manual one, so POST /api/fetch can't be used to hammer Apple.
+const manualFetchGap = time.Minute
+
+const (
+	// fetchAttempts is how many times a scheduled fetch is tried before
+	// waiting for the next tick; fetchRetryDelay is the wait after the
+	// first failure, doubling after each further one.
+	fetchAttempts   = 3
+	fetchRetryDelay = 30 * time.Second
+	// shutdownTimeout bounds how long in-flight requests get to finish
+	// after SIGINT or SIGTERM.
+	shutdownTimeout = 10 * time.Second
+	// serverIdleTimeout closes keep-alive connections left idle this long.
+	serverIdleTimeout = 60 * time.Second
+)
+
+// totalCountHeader carries the number of rows a paged endpoint could
+// return across all pages.
+const totalCountHeader = "X-Total-Count"
+
+// defaultPerPage is the page size when ?page= is given without ?per_page=.
+const defaultPerPage = 50
+
+// pageParams reads the optional page (from 1) and per_page query parameters
+// as a limit and offset. Without either it returns a limit of 0, meaning
+// everything. It writes a 400 and returns false on a value that is not a
+// positive integer.
+func pageParams(w http.ResponseWriter, r *http.Request) (limit, offset int, ok bool) {
+	query := r.URL.Query()
+	if query.Get("page") == "" && query.Get("per_page") == "" {
+		return 0, 0, true
+	}
+	page, perPage := 1, defaultPerPage
+	for name, value := range map[string]*int{"page": &page, "per_page": &perPage} {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			http.Error(w, name+" must be a positive integer", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		*value = n
+	}
+	return perPage, (page - 1) * perPage, true
+}
+
+// maxMultiCountries caps the countries one /api/timeseries-multi request
+// may ask for, since each costs a full time series computation.
+const maxMultiCountries = 10
+
+// countriesParam reads the required comma-separated countries query
+// parameter, lowercased and without repeats. It writes a 400 and returns
+// false when it is empty or names more than maxMultiCountries countries.
+func countriesParam(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var countries []string
+	seen := map[string]bool{}
+	for _, country := range splitCSV(r.URL.Query().Get("countries")) {
+		country = strings.ToLower(country)
+		if !seen[country] {
+			seen[country] = true
+			countries = append(countries, country)
+		}
+	}
+	if len(countries) == 0 {
+		http.Error(w, "countries query parameter is required", http.StatusBadRequest)
+		return nil, false
+	}
+	if len(countries) > maxMultiCountries {
+		http.Error(w, fmt.Sprintf("at most %d countries per request, got %d", maxMultiCountries, len(countries)), http.StatusBadRequest)
+		return nil, false
+	}
+	return countries, true
+}
+
+// chartParams reads the optional country and chart query parameters,
+// falling back to the server defaults. It writes a 400 and returns false when
+// the chart is not supported.
+func chartParams(w http.ResponseWriter, r *http.Request, fallbackCountry, fallbackChart string) (string, string, bool) {
+	country := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("country")))
+	if country == "" {
+		country = fallbackCountry
+	}
+	chart, ok := chartKeyParam(w, r, fallbackChart)
+	if !ok {
+		return "", "", false
+	}
+	return country, chart, true
+}
+
+// chartKeyParam reads the chart query parameter, which may be a chart key
+// such as top-free:6014, and the optional genre parameter into the store's
+// chart key. A genre parameter overrides the one in the key. It writes a 400
+// and returns false when the chart or genre is invalid.
+func chartKeyParam(w http.ResponseWriter, r *http.Request, fallbackChart string) (string, bool) {
+	key := strings.TrimSpace(r.URL.Query().Get("chart"))
+	if key == "" {
+		key = fallbackChart
+	}
+	chart, genre := store.SplitChartKey(key)
+	if param := strings.TrimSpace(r.URL.Query().Get("genre")); param != "" {
+		genre = param
+	}
+	if err := apple.CheckChart(chart); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	if genre != "" && !apple.ValidGenreID(genre) {
+		http.Error(w, fmt.Sprintf("invalid genre %q: must be a numeric genre id", genre), http.StatusBadRequest)
+		return "", false
+	}
+	return store.ChartKey(chart, genre), true
 }
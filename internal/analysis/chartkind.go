@@ -0,0 +1,32 @@
+package analysis
+
+// ChartKind is what a chart's ranks stand in for. Apple publishes no
+// download or revenue numbers, so rank is the proxy either way; the kind
+// only changes how a report describes the movements, never how they are
+// computed.
+type ChartKind string
+
+const (
+	// ChartKindDownloads covers the free and paid charts, ranked by recent
+	// downloads.
+	ChartKindDownloads ChartKind = "downloads"
+	// ChartKindRevenue is top-grossing, ranked by what apps earn, so its
+	// momentum is revenue momentum and its risk-on/off scores are revenue
+	// weighted.
+	ChartKindRevenue ChartKind = "revenue"
+	// ChartKindEditorial covers the curated new-apps and new-games lists,
+	// whose order is picked by editors rather than measured.
+	ChartKindEditorial ChartKind = "editorial"
+)
+
+// ChartKindOf returns the kind of the named chart (without a genre suffix).
+func ChartKindOf(chart string) ChartKind {
+	switch chart {
+	case "top-grossing":
+		return ChartKindRevenue
+	case "new-apps-we-love", "new-games-we-love":
+		return ChartKindEditorial
+	default:
+		return ChartKindDownloads
+	}
+}
@@ -0,0 +1,38 @@
+package analysis
+
+// CompositeRotation combines per-chart rotation indexes into a weighted
+// average. Charts without a weight default to 1; charts with a zero weight
+// are ignored.
+func CompositeRotation(indexes map[string]float64, weights map[string]float64) float64 {
+	var sum, total float64
+	for chart, value := range indexes {
+		weight, ok := weights[chart]
+		if !ok {
+			weight = 1
+		}
+		sum += weight * value
+		total += weight
+	}
+	if total == 0 {
+		return 0
+	}
+	return sum / total
+}
+
+// ComputeCustomIndexes evaluates each index definition as the weighted sum of
+// the named themes' scores. A theme without a score contributes 0; negative
+// weights let an index go long one theme and short another.
+func ComputeCustomIndexes(themeScores map[string]float64, defs map[string]map[string]float64) map[string]float64 {
+	if len(defs) == 0 {
+		return nil
+	}
+	indexes := make(map[string]float64, len(defs))
+	for name, weights := range defs {
+		var value float64
+		for theme, weight := range weights {
+			value += weight * themeScores[theme]
+		}
+		indexes[name] = value
+	}
+	return indexes
+}
@@ -0,0 +1,42 @@
+package analysis
+
+import "math"
+
+// Divergence is an app whose rank and review z-scores point in opposite
+// directions, e.g. climbing the chart while review growth stalls.
+type Divergence struct {
+	AppTrend
+	Gap       float64 `json:"gap"`
+	Direction string  `json:"direction"`
+}
+
+// FindDivergences returns apps whose rank and review z-scores have opposite
+// signs and both exceed threshold in magnitude, ordered by the size of the gap.
+func FindDivergences(trends []AppTrend, threshold float64) []Divergence {
+	var out []Divergence
+	for _, trend := range trends {
+		if trend.RankZ*trend.ReviewZ >= 0 {
+			continue
+		}
+		if math.Abs(trend.RankZ) < threshold || math.Abs(trend.ReviewZ) < threshold {
+			continue
+		}
+		direction := "rank-led"
+		if trend.ReviewZ > trend.RankZ {
+			direction = "review-led"
+		}
+		out = append(out, Divergence{
+			AppTrend:  trend,
+			Gap:       math.Abs(trend.RankZ - trend.ReviewZ),
+			Direction: direction,
+		})
+	}
+	for i := 0; i < len(out); i++ {
+		for j := i + 1; j < len(out); j++ {
+			if out[j].Gap > out[i].Gap {
+				out[i], out[j] = out[j], out[i]
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package analysis
+
+import (
+	"strings"
+	"time"
+)
+
+// DefaultLaunchWindow is how recently an app must have been released to
+// count as a launch when TrendConfig.LaunchWindow is zero.
+const DefaultLaunchWindow = 30 * 24 * time.Hour
+
+// releaseDateLayouts are the forms release dates arrive in: a bare date from
+// the RSS feed, a timestamp from iTunes lookups, and the long form older
+// feeds used.
+var releaseDateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"January 2, 2006",
+	"Jan 2, 2006",
+}
+
+// ParseReleaseDate parses a stored release date, reporting false when it is
+// empty or in no known layout.
+func ParseReleaseDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range releaseDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// recentlyReleased reports whether releaseDate falls within window before
+// at. A release date after at (pre-orders, clock skew) also counts.
+func recentlyReleased(releaseDate string, at time.Time, window time.Duration) bool {
+	released, ok := ParseReleaseDate(releaseDate)
+	if !ok {
+		return false
+	}
+	if window <= 0 {
+		window = DefaultLaunchWindow
+	}
+	return at.Sub(released) <= window
+}
@@ -0,0 +1,56 @@
+package analysis
+
+import "app_download_analyzer/internal/store"
+
+// ApplyRankMomentum fills RankVelocity and RankAcceleration on trends from a
+// run of consecutive snapshots, oldest first, ending with the snapshot the
+// trends were computed for. Each step's change is the rank improvement since
+// the previous snapshot, with an app off the chart counted at limit+1.
+// Velocity is the mean change over all steps; acceleration is the mean over
+// the recent half of the steps minus the mean over the earlier half. Fewer
+// than two snapshots leaves the fields unset, and acceleration needs at least
+// two steps.
+func ApplyRankMomentum(trends []AppTrend, snapshots []store.Snapshot, items [][]store.ChartItem) {
+	if len(snapshots) < 2 || len(snapshots) != len(items) {
+		return
+	}
+	ranks := make([]map[string]int, len(items))
+	for i, snapshotItems := range items {
+		ranks[i] = make(map[string]int, len(snapshotItems))
+		for _, item := range snapshotItems {
+			ranks[i][item.AppID] = item.Rank
+		}
+	}
+	rankAt := func(i int, appID string) int {
+		if rank, ok := ranks[i][appID]; ok {
+			return rank
+		}
+		return snapshots[i].Limit + 1
+	}
+
+	steps := len(snapshots) - 1
+	for t := range trends {
+		changes := make([]float64, steps)
+		for i := 1; i < len(snapshots); i++ {
+			changes[i-1] = float64(rankAt(i-1, trends[t].AppID) - rankAt(i, trends[t].AppID))
+		}
+		velocity := mean(changes)
+		trends[t].RankVelocity = &velocity
+		if steps >= 2 {
+			half := steps / 2
+			acceleration := mean(changes[half:]) - mean(changes[:half])
+			trends[t].RankAcceleration = &acceleration
+		}
+	}
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,19 @@
+package analysis
+
+// PercentileRank returns where value sits within series as a percentage in
+// [0, 100], counting ties as half below and half above.
+func PercentileRank(value float64, series []float64) float64 {
+	if len(series) == 0 {
+		return 0
+	}
+	var below, equal int
+	for _, v := range series {
+		switch {
+		case v < value:
+			below++
+		case v == value:
+			equal++
+		}
+	}
+	return (float64(below) + 0.5*float64(equal)) / float64(len(series)) * 100
+}
@@ -0,0 +1,102 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+)
+
+// ThemeShift is the change in a theme's momentum score between two analyses.
+type ThemeShift struct {
+	Theme string  `json:"theme"`
+	Delta float64 `json:"delta"`
+}
+
+// ThemeRotation names the theme that gained the most momentum and the one
+// that lost the most between two analyses.
+type ThemeRotation struct {
+	Into  ThemeShift `json:"into"`
+	OutOf ThemeShift `json:"out_of"`
+}
+
+// CompareThemeScores diffs two theme score maps, treating a theme missing
+// from one side as 0. It returns false when there are no themes to compare.
+func CompareThemeScores(previous, latest map[string]float64) (ThemeRotation, bool) {
+	deltas := map[string]float64{}
+	for theme, score := range latest {
+		deltas[theme] = score - previous[theme]
+	}
+	for theme, score := range previous {
+		if _, ok := latest[theme]; !ok {
+			deltas[theme] = -score
+		}
+	}
+	if len(deltas) == 0 {
+		return ThemeRotation{}, false
+	}
+
+	list := make([]ThemeScore, 0, len(deltas))
+	for theme, delta := range deltas {
+		list = append(list, ThemeScore{Theme: theme, Score: delta})
+	}
+	sortThemeScoresStable(list)
+	first, last := list[0], list[len(list)-1]
+	return ThemeRotation{
+		Into:  ThemeShift{Theme: first.Theme, Delta: first.Score},
+		OutOf: ThemeShift{Theme: last.Theme, Delta: last.Score},
+	}, true
+}
+
+// Headline renders the rotation as a one-line summary.
+func (r ThemeRotation) Headline() string {
+	return fmt.Sprintf("rotation into %s (%+.2f), out of %s (%+.2f)",
+		r.Into.Theme, r.Into.Delta, r.OutOf.Theme, r.OutOf.Delta)
+}
+
+// sortThemeScoresStable orders by score descending, breaking ties by name so
+// the result doesn't depend on map iteration order.
+func sortThemeScoresStable(list []ThemeScore) {
+	for i := 0; i < len(list); i++ {
+		for j := i + 1; j < len(list); j++ {
+			if list[j].Score > list[i].Score || (list[j].Score == list[i].Score && list[j].Theme < list[i].Theme) {
+				list[i], list[j] = list[j], list[i]
+			}
+		}
+	}
+}
+
+// RotationEvent marks a point in a rotation index series that moved
+// notably from the point before it.
+type RotationEvent struct {
+	Index int     `json:"index"`
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Delta float64 `json:"delta"`
+	// ZeroCross is set when the index changed sign, i.e. flipped between
+	// risk-on and risk-off.
+	ZeroCross bool `json:"zero_cross"`
+	// Jump is set when the index moved by more than the threshold.
+	Jump bool `json:"jump"`
+}
+
+// DetectRotationShifts returns the points in series where the rotation index
+// crossed zero or moved by more than threshold since the previous point,
+// in series order. A threshold <= 0 reports zero crossings only.
+func DetectRotationShifts(series []float64, threshold float64) []RotationEvent {
+	var events []RotationEvent
+	for i := 1; i < len(series); i++ {
+		from, to := series[i-1], series[i]
+		delta := to - from
+		event := RotationEvent{
+			Index:     i,
+			From:      from,
+			To:        to,
+			Delta:     delta,
+			ZeroCross: from*to < 0,
+			Jump:      threshold > 0 && math.Abs(delta) > threshold,
+		}
+		if event.ZeroCross || event.Jump {
+			events = append(events, event)
+		}
+	}
+	return events
+}
@@ -0,0 +1,64 @@
+package analysis
+
+import "time"
+
+// MinSeasonalityDays is the history needed before day-of-week baselines are
+// trusted: two weeks gives every weekday at least two samples.
+const MinSeasonalityDays = 14
+
+// DailyThemeScores is one day's theme momentum, as in TrendResult.ThemeScores.
+type DailyThemeScores struct {
+	Day    time.Time
+	Scores map[string]float64
+}
+
+// DayOfWeekBaselines averages each theme's score per weekday over history.
+// A theme missing from a day counts as 0 for that day.
+func DayOfWeekBaselines(history []DailyThemeScores) map[time.Weekday]map[string]float64 {
+	themes := map[string]bool{}
+	for _, day := range history {
+		for theme := range day.Scores {
+			themes[theme] = true
+		}
+	}
+	sums := map[time.Weekday]map[string]float64{}
+	counts := map[time.Weekday]int{}
+	for _, day := range history {
+		weekday := day.Day.Weekday()
+		if sums[weekday] == nil {
+			sums[weekday] = map[string]float64{}
+		}
+		for theme := range themes {
+			sums[weekday][theme] += day.Scores[theme]
+		}
+		counts[weekday]++
+	}
+	for weekday, themeSums := range sums {
+		for theme := range themeSums {
+			themeSums[theme] /= float64(counts[weekday])
+		}
+	}
+	return sums
+}
+
+// ThemeScoresDeviation returns latest's theme scores minus the mean for the
+// same weekday over history, so a weekend lift in games is not read as a
+// rotation. history should hold one entry per day and exclude latest. Every
+// deviation is 0 when history has fewer than MinSeasonalityDays days.
+func ThemeScoresDeviation(latest DailyThemeScores, history []DailyThemeScores) map[string]float64 {
+	deviation := make(map[string]float64, len(latest.Scores))
+	for theme := range latest.Scores {
+		deviation[theme] = 0
+	}
+	if len(history) < MinSeasonalityDays {
+		return deviation
+	}
+	baseline, ok := DayOfWeekBaselines(history)[latest.Day.Weekday()]
+	if !ok {
+		return deviation
+	}
+	for theme, score := range latest.Scores {
+		deviation[theme] = score - baseline[theme]
+	}
+	return deviation
+}
@@ -0,0 +1,66 @@
+package analysis
+
+import "math"
+
+// SmoothSeries returns the exponentially weighted moving average of values:
+// each point is alpha times the value plus (1-alpha) times the previous
+// smoothed point, seeded with the first value. alpha must be in (0, 1];
+// higher values follow the raw series more closely.
+func SmoothSeries(values []float64, alpha float64) []float64 {
+	out := make([]float64, len(values))
+	for i, v := range values {
+		if i == 0 {
+			out[i] = v
+			continue
+		}
+		out[i] = alpha*v + (1-alpha)*out[i-1]
+	}
+	return out
+}
+
+// MovingAverage returns the simple moving average of series over window
+// points. The first window-1 points, where the window is not yet full, are
+// NaN; a window below 1 yields all NaN.
+func MovingAverage(series []float64, window int) []float64 {
+	out := make([]float64, len(series))
+	var sum float64
+	for i, v := range series {
+		sum += v
+		if window > 0 && i >= window {
+			sum -= series[i-window]
+		}
+		if window < 1 || i < window-1 {
+			out[i] = math.NaN()
+			continue
+		}
+		out[i] = sum / float64(window)
+	}
+	return out
+}
+
+const (
+	SignalBullish = "bullish"
+	SignalBearish = "bearish"
+	SignalNeutral = "neutral"
+)
+
+// CrossoverSignals compares a fast and a slow moving average point by point:
+// bullish while fast is above slow, bearish while below, so the signal flips
+// where the averages cross. Points where either average is NaN, or the two
+// are equal, are neutral.
+func CrossoverSignals(fast, slow []float64) []string {
+	signals := make([]string, len(fast))
+	for i := range fast {
+		switch {
+		case i >= len(slow) || math.IsNaN(fast[i]) || math.IsNaN(slow[i]):
+			signals[i] = SignalNeutral
+		case fast[i] > slow[i]:
+			signals[i] = SignalBullish
+		case fast[i] < slow[i]:
+			signals[i] = SignalBearish
+		default:
+			signals[i] = SignalNeutral
+		}
+	}
+	return signals
+}
@@ -0,0 +1,128 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+
+	"app_download_analyzer/internal/store"
+)
+
+// RankCorrelation returns the Spearman rank correlation between two
+// snapshots over the apps present in both, along with the number of shared
+// apps. Ranks are re-ranked within the shared set so apps entering or
+// leaving the chart don't distort the measure. Values near 1 mean the chart
+// kept its order; fewer than two shared apps yields 0.
+func RankCorrelation(previousItems, latestItems []store.ChartItem) (float64, int) {
+	prevRanks := make(map[string]int, len(previousItems))
+	for _, item := range previousItems {
+		prevRanks[item.AppID] = item.Rank
+	}
+
+	type pair struct {
+		prev, latest int
+	}
+	var shared []pair
+	for _, item := range latestItems {
+		if prevRank, ok := prevRanks[item.AppID]; ok {
+			shared = append(shared, pair{prev: prevRank, latest: item.Rank})
+		}
+	}
+	n := len(shared)
+	if n < 2 {
+		return 0, n
+	}
+
+	prevOrder := make([]int, n)
+	latestOrder := make([]int, n)
+	for i := range shared {
+		prevOrder[i] = i
+		latestOrder[i] = i
+	}
+	sort.Slice(prevOrder, func(i, j int) bool { return shared[prevOrder[i]].prev < shared[prevOrder[j]].prev })
+	sort.Slice(latestOrder, func(i, j int) bool { return shared[latestOrder[i]].latest < shared[latestOrder[j]].latest })
+	prevPos := make([]int, n)
+	latestPos := make([]int, n)
+	for pos, idx := range prevOrder {
+		prevPos[idx] = pos
+	}
+	for pos, idx := range latestOrder {
+		latestPos[idx] = pos
+	}
+
+	var sumSq float64
+	for i := 0; i < n; i++ {
+		d := float64(prevPos[i] - latestPos[i])
+		sumSq += d * d
+	}
+	nf := float64(n)
+	return 1 - 6*sumSq/(nf*(nf*nf-1)), n
+}
+
+// StickyBand is the widest rank range, best to worst, an app may span over
+// the window and still count as sticky.
+const StickyBand = 3
+
+// StickyApp is an app that held its chart position across a window of
+// snapshots.
+type StickyApp struct {
+	AppID        string  `json:"app_id"`
+	AppName      string  `json:"app_name"`
+	MeanRank     float64 `json:"mean_rank"`
+	RankVariance float64 `json:"rank_variance"`
+	BestRank     int     `json:"best_rank"`
+	WorstRank    int     `json:"worst_rank"`
+}
+
+// StickyApps returns the apps charted in every one of the last window
+// snapshots (oldest first, as for ApplyRankMomentum) whose rank stayed
+// within StickyBand places, ordered by mean rank. RankVariance is the
+// population variance of the app's ranks. Fewer than two snapshots in the
+// window yields nil.
+func StickyApps(snapshots []store.Snapshot, items [][]store.ChartItem, window int) []StickyApp {
+	if len(snapshots) != len(items) {
+		return nil
+	}
+	if window > 0 && window < len(items) {
+		items = items[len(items)-window:]
+	}
+	if len(items) < 2 {
+		return nil
+	}
+
+	ranks := map[string][]float64{}
+	for _, snapshotItems := range items {
+		for _, item := range snapshotItems {
+			ranks[item.AppID] = append(ranks[item.AppID], float64(item.Rank))
+		}
+	}
+	var sticky []StickyApp
+	for _, item := range items[len(items)-1] {
+		appRanks := ranks[item.AppID]
+		if len(appRanks) != len(items) {
+			continue
+		}
+		best, worst := appRanks[0], appRanks[0]
+		for _, rank := range appRanks {
+			best = math.Min(best, rank)
+			worst = math.Max(worst, rank)
+		}
+		if worst-best > StickyBand {
+			continue
+		}
+		avg := mean(appRanks)
+		var variance float64
+		for _, rank := range appRanks {
+			variance += (rank - avg) * (rank - avg)
+		}
+		sticky = append(sticky, StickyApp{
+			AppID:        item.AppID,
+			AppName:      item.AppName,
+			MeanRank:     avg,
+			RankVariance: variance / float64(len(appRanks)),
+			BestRank:     int(best),
+			WorstRank:    int(worst),
+		})
+	}
+	sort.SliceStable(sticky, func(i, j int) bool { return sticky[i].MeanRank < sticky[j].MeanRank })
+	return sticky
+}
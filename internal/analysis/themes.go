@@ -2,8 +2,14 @@ package analysis
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"app_download_analyzer/internal/store"
 )
 
 type ThemeRule struct {
@@ -11,12 +17,54 @@ type ThemeRule struct {
 	GenreIDs []string `json:"genre_ids"`
 	Genres   []string `json:"genres"`
 	Keywords []string `json:"keywords"`
+	// Patterns are RE2 regular expressions matched against the lowercased
+	// app name, for rules that need word boundaries or alternation.
+	Patterns []string `json:"patterns,omitempty"`
 }
 
 type ThemeConfig struct {
 	Rules   []ThemeRule `json:"rules"`
 	RiskOn  []string    `json:"risk_on"`
 	RiskOff []string    `json:"risk_off"`
+	// IgnorePatterns drops apps whose name contains any pattern as whole
+	// words (case-insensitive), e.g. test or placeholder entries. "test"
+	// matches "Test Build" but not "Speedtest".
+	IgnorePatterns []string `json:"ignore_patterns,omitempty"`
+	// IgnoreStage selects where ignored apps are dropped: "analyze" (default)
+	// keeps them in the DB but out of scoring, "fetch" never stores them.
+	IgnoreStage string `json:"ignore_stage,omitempty"`
+	// Indexes defines custom signals as weighted sums of theme scores,
+	// keyed by index name, e.g. {"crypto_sentiment": {"finance": 0.5}}.
+	Indexes map[string]map[string]float64 `json:"indexes,omitempty"`
+}
+
+const (
+	IgnoreAtFetch   = "fetch"
+	IgnoreAtAnalyze = "analyze"
+)
+
+// IgnoresAt reports whether ignore patterns apply at the given stage.
+func (cfg ThemeConfig) IgnoresAt(stage string) bool {
+	if len(cfg.IgnorePatterns) == 0 {
+		return false
+	}
+	configured := cfg.IgnoreStage
+	if configured == "" {
+		configured = IgnoreAtAnalyze
+	}
+	return configured == stage
+}
+
+// IsIgnored reports whether name contains one of the ignore patterns as
+// whole words.
+func (cfg ThemeConfig) IsIgnored(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range normalizeList(cfg.IgnorePatterns) {
+		if containsWords(name, pattern) {
+			return true
+		}
+	}
+	return false
 }
 
 type ThemeScore struct {
@@ -25,22 +73,68 @@ type ThemeScore struct {
 }
 
 func LoadThemeConfig(path string) (ThemeConfig, error) {
+	data, err := ReadThemeConfigContent(path)
+	if err != nil {
+		return ThemeConfig{}, err
+	}
+	return ParseThemeConfig(data)
+}
+
+// ReadThemeConfigContent returns the raw theme config at path, or the
+// encoded default config when the file does not exist.
+func ReadThemeConfigContent(path string) ([]byte, error) {
 	if _, err := os.Stat(path); err != nil {
 		if os.IsNotExist(err) {
-			return defaultThemeConfig(), nil
+			return json.Marshal(defaultThemeConfig())
 		}
-		return ThemeConfig{}, err
-	}
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return ThemeConfig{}, err
+		return nil, err
 	}
+	return os.ReadFile(path)
+}
+
+func ParseThemeConfig(data []byte) (ThemeConfig, error) {
 	var cfg ThemeConfig
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return ThemeConfig{}, err
 	}
 	if len(cfg.Rules) == 0 {
-		return defaultThemeConfig(), nil
+		// A config holding only ignore patterns or indexes builds on the
+		// default themes rather than replacing itself with them.
+		defaults := defaultThemeConfig()
+		cfg.Rules = defaults.Rules
+		if len(cfg.RiskOn) == 0 && len(cfg.RiskOff) == 0 {
+			cfg.RiskOn, cfg.RiskOff = defaults.RiskOn, defaults.RiskOff
+		}
+	}
+	switch cfg.IgnoreStage {
+	case "", IgnoreAtAnalyze, IgnoreAtFetch:
+	default:
+		return ThemeConfig{}, fmt.Errorf("ignore_stage %q is neither %q nor %q", cfg.IgnoreStage, IgnoreAtAnalyze, IgnoreAtFetch)
+	}
+	for _, rule := range cfg.Rules {
+		for _, pattern := range rule.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return ThemeConfig{}, fmt.Errorf("theme %q: invalid pattern %q: %w", rule.Theme, pattern, err)
+			}
+		}
+	}
+	// A misspelled theme would silently weigh 0, so reject it up front.
+	// Classification lowercases theme names, so compare them lowercased and
+	// key the weights the same way the theme scores are keyed.
+	known := map[string]bool{"other": true}
+	for _, rule := range cfg.Rules {
+		known[strings.ToLower(strings.TrimSpace(rule.Theme))] = true
+	}
+	for name, weights := range cfg.Indexes {
+		normalized := make(map[string]float64, len(weights))
+		for theme, weight := range weights {
+			key := strings.ToLower(strings.TrimSpace(theme))
+			if !known[key] {
+				return ThemeConfig{}, fmt.Errorf("index %q: unknown theme %q", name, theme)
+			}
+			normalized[key] += weight
+		}
+		cfg.Indexes[name] = normalized
 	}
 	return cfg, nil
 }
@@ -73,6 +167,7 @@ type normalizedRule struct {
 	genreIDs map[string]bool
 	genres   []string
 	keywords []string
+	patterns []*regexp.Regexp
 }
 
 type ThemeInput struct {
@@ -83,6 +178,26 @@ type ThemeInput struct {
 	ItunesGenres []string
 }
 
+// ItemThemeInput builds the classifier input for a stored chart item.
+func ItemThemeInput(item store.ChartItem) ThemeInput {
+	return ThemeInput{
+		Name:         item.AppName,
+		Genres:       item.Genres,
+		GenreIDs:     item.GenreIDs,
+		PrimaryGenre: item.PrimaryGenre,
+		ItunesGenres: item.ItunesGenres,
+	}
+}
+
+// ClassifyItem returns the theme stored with item at collection time,
+// falling back to Classify for older rows or when reclassify is set.
+func (c *ThemeClassifier) ClassifyItem(item store.ChartItem, reclassify bool) string {
+	if item.Theme != "" && !reclassify {
+		return item.Theme
+	}
+	return c.Classify(ItemThemeInput(item))
+}
+
 func NewThemeClassifier(cfg ThemeConfig) *ThemeClassifier {
 	rules := make([]normalizedRule, 0, len(cfg.Rules))
 	for _, rule := range cfg.Rules {
@@ -95,35 +210,111 @@ func NewThemeClassifier(cfg ThemeConfig) *ThemeClassifier {
 		for _, id := range rule.GenreIDs {
 			n.genreIDs[strings.TrimSpace(id)] = true
 		}
+		for _, pattern := range rule.Patterns {
+			// Patterns are validated by ParseThemeConfig; anything that
+			// still fails to compile is skipped.
+			if re, err := regexp.Compile(pattern); err == nil {
+				n.patterns = append(n.patterns, re)
+			}
+		}
 		rules = append(rules, n)
 	}
 	return &ThemeClassifier{rules: rules}
 }
 
+// Classify returns the theme ClassifyWeighted gives the most weight, i.e.
+// the one whose rules match the most genre ids, genres and keywords; ties go
+// to the theme that comes first in the config. Apps matching no rule are
+// "other".
 func (c *ThemeClassifier) Classify(input ThemeInput) string {
-	genres := normalizeList(append(input.Genres, append(input.ItunesGenres, input.PrimaryGenre)...))
-	genreIDs := make(map[string]bool, len(input.GenreIDs))
+	themes, matches := c.themeMatches(input)
+	best, bestMatches := "other", 0
+	for _, theme := range themes {
+		if matches[theme] > bestMatches {
+			best, bestMatches = theme, matches[theme]
+		}
+	}
+	return best
+}
+
+// ClassifyWeighted spreads an app across every theme whose rule matches it,
+// weighted by how many genre ids, genres and keywords matched, normalized to
+// sum to 1. Apps matching no rule are fully "other".
+func (c *ThemeClassifier) ClassifyWeighted(input ThemeInput) map[string]float64 {
+	_, matches := c.themeMatches(input)
+	var total int
+	for _, n := range matches {
+		total += n
+	}
+	if total == 0 {
+		return map[string]float64{"other": 1}
+	}
+	weights := make(map[string]float64, len(matches))
+	for theme, n := range matches {
+		weights[theme] = float64(n) / float64(total)
+	}
+	return weights
+}
+
+// themeMatches counts, per theme, the genre ids, genres, keywords and
+// patterns of its rules that input matches, and returns the matched themes
+// in config order. RSS genres, iTunes genres and the primary genre often
+// repeat one another, so each distinct genre and genre id counts once.
+func (c *ThemeClassifier) themeMatches(input ThemeInput) ([]string, map[string]int) {
+	genres := uniqueStrings(normalizeList(append(append(append([]string{}, input.Genres...), input.ItunesGenres...), input.PrimaryGenre)))
+	genreIDs := make([]string, 0, len(input.GenreIDs))
 	for _, id := range input.GenreIDs {
-		genreIDs[strings.TrimSpace(id)] = true
+		genreIDs = append(genreIDs, strings.TrimSpace(id))
 	}
+	genreIDs = uniqueStrings(genreIDs)
 	name := strings.ToLower(input.Name)
 
+	var themes []string
+	matches := map[string]int{}
 	for _, rule := range c.rules {
-		for id := range genreIDs {
+		n := 0
+		for _, id := range genreIDs {
 			if rule.genreIDs[id] {
-				return rule.theme
+				n++
 			}
 		}
 		for _, genre := range genres {
 			if containsAny(genre, rule.genres) {
-				return rule.theme
+				n++
 			}
 		}
-		if rule.keywords != nil && containsAny(name, rule.keywords) {
-			return rule.theme
+		for _, keyword := range rule.keywords {
+			if keyword != "" && strings.Contains(name, keyword) {
+				n++
+			}
 		}
+		for _, re := range rule.patterns {
+			if re.MatchString(name) {
+				n++
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		if _, seen := matches[rule.theme]; !seen {
+			themes = append(themes, rule.theme)
+		}
+		matches[rule.theme] += n
 	}
-	return "other"
+	return themes, matches
+}
+
+// uniqueStrings drops repeats from values, keeping the first of each.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := values[:0]
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			out = append(out, value)
+		}
+	}
+	return out
 }
 
 func SortThemeScores(scores map[string]float64) []ThemeScore {
@@ -165,3 +356,27 @@ func containsAny(value string, candidates []string) bool {
 	}
 	return false
 }
+
+// containsWords reports whether value contains words at word boundaries:
+// neither end of the match may touch another letter or digit.
+func containsWords(value, words string) bool {
+	for offset := 0; ; {
+		idx := strings.Index(value[offset:], words)
+		if idx < 0 {
+			return false
+		}
+		start := offset + idx
+		end := start + len(words)
+		before, _ := utf8.DecodeLastRuneInString(value[:start])
+		after, _ := utf8.DecodeRuneInString(value[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(value[start:])
+		offset = start + size
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,128 @@
+package analysis
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseThemeConfigMergesDefaultRules(t *testing.T) {
+	cfg, err := ParseThemeConfig([]byte(`{
+		"ignore_patterns": ["test app"],
+		"ignore_stage": "fetch",
+		"indexes": {"leisure": {"Games": 1, "travel": 0.5}}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseThemeConfig: %v", err)
+	}
+	if len(cfg.Rules) != len(defaultThemeConfig().Rules) {
+		t.Errorf("got %d rules, want the %d default rules", len(cfg.Rules), len(defaultThemeConfig().Rules))
+	}
+	if len(cfg.RiskOn) == 0 || len(cfg.RiskOff) == 0 {
+		t.Error("default risk_on/risk_off were not merged in")
+	}
+	if !cfg.IgnoresAt(IgnoreAtFetch) || !cfg.IsIgnored("My Test App") {
+		t.Error("ignore settings were dropped")
+	}
+	if got := cfg.Indexes["leisure"]; got["games"] != 1 || got["travel"] != 0.5 {
+		t.Errorf("index weights = %v, want lowercased theme keys", got)
+	}
+}
+
+func TestParseThemeConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string // empty when the config is valid
+	}{
+		{"unknown ignore stage", `{"ignore_patterns": ["x"], "ignore_stage": "store"}`, `ignore_stage "store"`},
+		{"unknown index theme", `{"indexes": {"i": {"gaming": 1}}}`, `unknown theme "gaming"`},
+		{"index matches rule case-insensitively", `{"rules": [{"theme": "Crypto", "keywords": ["coin"]}], "indexes": {"i": {"crypto": 1}}}`, ""},
+		{"invalid pattern", `{"rules": [{"theme": "x", "patterns": ["("]}]}`, `invalid pattern`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseThemeConfig([]byte(tt.config))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("expected an error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsIgnoredMatchesWholeWords(t *testing.T) {
+	cfg := ThemeConfig{IgnorePatterns: []string{"test", "Beta Build", "테스트"}}
+	tests := []struct {
+		name    string
+		ignored bool
+	}{
+		{"Test", true},
+		{"My Test App", true},
+		{"test-app", true},
+		{"App (beta build)", true},
+		{"테스트 앱", true},
+		{"Speedtest by Ookla", false},
+		{"Testflight", false},
+		{"Contest Maker", false},
+		{"Beta Builder", false},
+		{"Tested", false},
+	}
+	for _, tt := range tests {
+		if got := cfg.IsIgnored(tt.name); got != tt.ignored {
+			t.Errorf("IsIgnored(%q) = %v, want %v", tt.name, got, tt.ignored)
+		}
+	}
+}
+
+func TestClassifyPicksMostWeightedTheme(t *testing.T) {
+	classifier := NewThemeClassifier(ThemeConfig{Rules: []ThemeRule{
+		{Theme: "games", GenreIDs: []string{"6014"}},
+		{Theme: "social", Genres: []string{"social networking"}, Keywords: []string{"chat"}},
+	}})
+	tests := []struct {
+		name    string
+		input   ThemeInput
+		want    string
+		weights map[string]float64
+	}{
+		{
+			"repeated genre counts once, tie goes to config order",
+			ThemeInput{Name: "Party", GenreIDs: []string{"6014", "6014"}, Genres: []string{"Social Networking"}, ItunesGenres: []string{"Social Networking"}, PrimaryGenre: "Social Networking"},
+			"games",
+			map[string]float64{"games": 0.5, "social": 0.5},
+		},
+		{
+			"later theme with more matches wins",
+			ThemeInput{Name: "Party Chat", GenreIDs: []string{"6014"}, PrimaryGenre: "Social Networking"},
+			"social",
+			map[string]float64{"games": 1.0 / 3, "social": 2.0 / 3},
+		},
+		{
+			"no match",
+			ThemeInput{Name: "Calculator", PrimaryGenre: "Utilities"},
+			"other",
+			map[string]float64{"other": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifier.Classify(tt.input); got != tt.want {
+				t.Errorf("Classify = %q, want %q", got, tt.want)
+			}
+			got := classifier.ClassifyWeighted(tt.input)
+			if len(got) != len(tt.weights) {
+				t.Fatalf("ClassifyWeighted = %v, want %v", got, tt.weights)
+			}
+			for theme, want := range tt.weights {
+				if math.Abs(got[theme]-want) > 1e-9 {
+					t.Errorf("ClassifyWeighted = %v, want %v", got, tt.weights)
+				}
+			}
+		})
+	}
+}
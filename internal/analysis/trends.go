@@ -1,39 +1,151 @@
 package analysis
 
 import (
+	"errors"
 	"math"
+	"slices"
+	"strings"
+	"time"
 
 	"app_download_analyzer/internal/store"
 )
 
+// ErrInsufficientHistory is returned when an analysis needs two snapshots to
+// compare and the chart has only one.
+var ErrInsufficientHistory = errors.New("need at least two snapshots")
+
 type TrendConfig struct {
 	RankWeight    float64
 	ReviewWeight  float64
 	NewEntryBonus float64
+	// NormalizePerDay sets each trend's RatingDeltaPerDay. It is for display
+	// only: every app in one comparison shares the interval, so dividing by
+	// it would leave the z-scores and percentiles, and so the scores,
+	// unchanged.
+	NormalizePerDay bool
+	// WeightedThemes spreads each app's score across all matching themes
+	// (see ClassifyWeighted) when computing theme momentum.
+	WeightedThemes bool
+	// ScoreMethod is ScoreZScore (default) or ScorePercentile.
+	ScoreMethod string
+	// Reclassify ignores the theme stored with each chart item and runs the
+	// current theme config instead.
+	Reclassify bool
+	// RatingAvgWeight weights the scaled average rating delta in the trend
+	// score; zero leaves it out.
+	RatingAvgWeight float64
+	// LaunchWindow is how recently an app must have been released, before
+	// the latest snapshot, to be RecentlyReleased; zero selects
+	// DefaultLaunchWindow.
+	LaunchWindow time.Duration
+}
+
+const (
+	// ScoreZScore standardizes rank and review deltas against the snapshot's
+	// mean and standard deviation.
+	ScoreZScore = "zscore"
+	// ScorePercentile ranks each delta within the snapshot and centres the
+	// rank into [-1, 1], which keeps a single outlier from flattening
+	// everyone else.
+	ScorePercentile = "percentile"
+)
+
+// ValidScoreMethod reports whether method is a supported ScoreMethod; empty
+// selects the default.
+func ValidScoreMethod(method string) bool {
+	return method == "" || method == ScoreZScore || method == ScorePercentile
 }
 
 type AppTrend struct {
-	AppID       string  `json:"app_id"`
-	AppName     string  `json:"app_name"`
-	AppURL      string  `json:"app_url"`
-	Rank        int     `json:"rank"`
-	RankDelta   int     `json:"rank_delta"`
-	RatingCount int     `json:"rating_count"`
-	RatingDelta int     `json:"rating_delta"`
-	TrendScore  float64 `json:"trend_score"`
-	Theme       string  `json:"theme"`
-	NewEntry    bool    `json:"new_entry"`
+	AppID      string `json:"app_id"`
+	AppName    string `json:"app_name"`
+	AppURL     string `json:"app_url"`
+	ArtworkURL string `json:"artwork_url"`
+	// ArtworkURLLarge is ArtworkURL rewritten to a larger icon; see
+	// apple.ArtworkURL.
+	ArtworkURLLarge string `json:"artwork_url_large,omitempty"`
+	Rank            int    `json:"rank"`
+	RankDelta       int    `json:"rank_delta"`
+	// RankVelocity is the average rank change per snapshot over the recent
+	// history, and RankAcceleration how much faster the recent half of that
+	// history moved than the earlier half; see ApplyRankMomentum.
+	RankVelocity     *float64 `json:"rank_velocity,omitempty"`
+	RankAcceleration *float64 `json:"rank_acceleration,omitempty"`
+	// RatingCount and AverageRating are nil when iTunes metadata is
+	// missing, e.g. for --no-itunes fetches.
+	RatingCount        *int     `json:"rating_count"`
+	AverageRating      *float64 `json:"average_rating"`
+	RatingCountDisplay string   `json:"rating_count_display,omitempty"`
+	RatingDelta        *int     `json:"rating_delta"`
+	// RatingDeltaPerDay is the rating count growth per day between the two
+	// snapshots; set only when TrendConfig.NormalizePerDay is on.
+	RatingDeltaPerDay *float64 `json:"rating_delta_per_day,omitempty"`
+	// AverageRatingDelta is the change in average user rating since the
+	// previous snapshot; nil for new entries or when either side is unknown.
+	AverageRatingDelta *float64 `json:"average_rating_delta"`
+	TrendScore         float64  `json:"trend_score"`
+	// RankZ and ReviewZ are z-scores, or centred percentile ranks in
+	// [-1, 1] under ScorePercentile.
+	RankZ   float64 `json:"rank_z"`
+	ReviewZ float64 `json:"review_z"`
+	Theme   string  `json:"theme"`
+	// ThemeWeights is the app's share in each matching theme; set only when
+	// TrendConfig.WeightedThemes is on.
+	ThemeWeights map[string]float64 `json:"theme_weights,omitempty"`
+	Genre        string             `json:"genre"`
+	// NewEntry means the app was not in the previous snapshot, whether
+	// newly launched or re-entering; RecentlyReleased means its release date
+	// is within TrendConfig.LaunchWindow.
+	NewEntry         bool `json:"new_entry"`
+	RecentlyReleased bool `json:"recently_released"`
+}
+
+// AppExit is an app that was in the previous snapshot but has dropped out of
+// the latest one.
+type AppExit struct {
+	AppID        string `json:"app_id"`
+	AppName      string `json:"app_name"`
+	AppURL       string `json:"app_url"`
+	PreviousRank int    `json:"previous_rank"`
+	Theme        string `json:"theme"`
+	Genre        string `json:"genre"`
 }
 
 type TrendResult struct {
-	Trends        []AppTrend
-	ThemeScores   map[string]float64
+	Trends      []AppTrend
+	Exits       []AppExit
+	Ignored     []string
+	ThemeScores map[string]float64
+	// ThemeCounts is the number of apps behind each ThemeScores entry; with
+	// WeightedThemes an app counts toward every theme it has weight in.
+	ThemeCounts   map[string]int
 	RiskOnScore   float64
 	RiskOffScore  float64
 	RotationIndex float64
+	// Indexes holds the theme config's custom indexes; see
+	// ComputeCustomIndexes.
+	Indexes map[string]float64
+	// Volatility measures chart turbulence between the two snapshots:
+	//
+	//	mean(|rank delta|) over apps in both snapshots
+	//	  + VolatilityChurnPenalty * (new entries + exits)
+	//
+	// A quiet chart sits near 0; a spike means apps either moved far or
+	// churned in and out of the chart.
+	Volatility float64
 }
 
+// VolatilityChurnPenalty is the volatility added for each app entering or
+// leaving the chart.
+const VolatilityChurnPenalty = 1.0
+
 func AnalyzeTrends(latest store.Snapshot, previous store.Snapshot, latestItems, previousItems []store.ChartItem, cfg TrendConfig, themes ThemeConfig) TrendResult {
+	var ignored []string
+	if themes.IgnoresAt(IgnoreAtAnalyze) {
+		latestItems, ignored = FilterIgnored(latestItems, themes)
+		previousItems, _ = FilterIgnored(previousItems, themes)
+	}
+
 	prevMap := map[string]store.ChartItem{}
 	for _, item := range previousItems {
 		prevMap[item.AppID] = item
@@ -41,10 +153,14 @@ func AnalyzeTrends(latest store.Snapshot, previous store.Snapshot, latestItems,
 
 	rankDeltas := make([]float64, 0, len(latestItems))
 	reviewDeltas := make([]float64, 0, len(latestItems))
+	avgRatingDeltas := make([]float64, 0, len(latestItems))
 	trends := make([]AppTrend, 0, len(latestItems))
 
 	classifier := NewThemeClassifier(themes)
 
+	elapsedDays := latest.DataTime().Sub(previous.DataTime()).Hours() / 24
+	perDay := cfg.NormalizePerDay && elapsedDays > 0
+
 	for _, item := range latestItems {
 		prev, ok := prevMap[item.AppID]
 		prevRank := latest.Limit + 1
@@ -53,57 +169,107 @@ func AnalyzeTrends(latest store.Snapshot, previous store.Snapshot, latestItems,
 		}
 		rankDelta := prevRank - item.Rank
 
-		ratingDelta := computeRatingDelta(item, prev, ok)
+		ratingDelta, known := computeRatingDelta(item, prev, ok)
 		rankDeltas = append(rankDeltas, float64(rankDelta))
-		reviewDeltas = append(reviewDeltas, float64(ratingDelta))
-
-		theme := classifier.Classify(ThemeInput{
-			Name:         item.AppName,
-			Genres:       item.Genres,
-			GenreIDs:     item.GenreIDs,
-			PrimaryGenre: item.PrimaryGenre,
-			ItunesGenres: item.ItunesGenres,
-		})
+		var ratingDeltaPtr *int
+		var perDayPtr *float64
+		if known {
+			// Apps without rating data stay out of the review statistics so
+			// they don't pull the mean toward zero.
+			ratingDeltaPtr = &ratingDelta
+			if perDay {
+				growth := float64(ratingDelta) / elapsedDays
+				perDayPtr = &growth
+			}
+			reviewDeltas = append(reviewDeltas, float64(ratingDelta))
+		}
+
+		var avgRatingDelta *float64
+		if ok && item.AverageRating.Valid && prev.AverageRating.Valid {
+			delta := item.AverageRating.Value - prev.AverageRating.Value
+			avgRatingDelta = &delta
+			avgRatingDeltas = append(avgRatingDeltas, delta)
+		}
+
+		theme := classifier.ClassifyItem(item, cfg.Reclassify)
+		var themeWeights map[string]float64
+		if cfg.WeightedThemes {
+			themeWeights = classifier.ClassifyWeighted(ItemThemeInput(item))
+		}
 
 		trends = append(trends, AppTrend{
-			AppID:       item.AppID,
-			AppName:     item.AppName,
-			AppURL:      item.AppURL,
-			Rank:        item.Rank,
-			RankDelta:   rankDelta,
-			RatingCount: item.RatingCount.Value,
-			RatingDelta: ratingDelta,
-			Theme:       theme,
-			NewEntry:    !ok,
+			AppID:              item.AppID,
+			AppName:            item.AppName,
+			AppURL:             item.AppURL,
+			ArtworkURL:         item.ArtworkURL,
+			Rank:               item.Rank,
+			RankDelta:          rankDelta,
+			RatingCount:        item.RatingCount.Ptr(),
+			AverageRating:      item.AverageRating.Ptr(),
+			RatingDelta:        ratingDeltaPtr,
+			RatingDeltaPerDay:  perDayPtr,
+			AverageRatingDelta: avgRatingDelta,
+			Theme:              theme,
+			ThemeWeights:       themeWeights,
+			Genre:              primaryGenre(item),
+			NewEntry:           !ok,
+			RecentlyReleased:   recentlyReleased(item.ReleaseDate, latest.CollectedAt, cfg.LaunchWindow),
 		})
 	}
 
-	rankMean, rankStd := meanStd(rankDeltas)
-	reviewMean, reviewStd := meanStd(reviewDeltas)
+	rankScale := newDeltaScale(cfg.ScoreMethod, rankDeltas)
+	reviewScale := newDeltaScale(cfg.ScoreMethod, reviewDeltas)
+	avgRatingScale := newDeltaScale(cfg.ScoreMethod, avgRatingDeltas)
 
 	for i := range trends {
-		rankZ := zscore(float64(trends[i].RankDelta), rankMean, rankStd)
-		reviewZ := zscore(float64(trends[i].RatingDelta), reviewMean, reviewStd)
+		rankZ := rankScale.score(float64(trends[i].RankDelta))
+		// Apps without a known rating delta sit at the neutral point.
+		var reviewZ float64
+		if trends[i].RatingDelta != nil {
+			reviewZ = reviewScale.score(float64(*trends[i].RatingDelta))
+		}
 		score := cfg.RankWeight*rankZ + cfg.ReviewWeight*reviewZ
+		if cfg.RatingAvgWeight != 0 {
+			var avgZ float64
+			if trends[i].AverageRatingDelta != nil {
+				avgZ = avgRatingScale.score(*trends[i].AverageRatingDelta)
+			}
+			score += cfg.RatingAvgWeight * avgZ
+		}
 		if trends[i].NewEntry {
 			score += cfg.NewEntryBonus
 		}
 		trends[i].TrendScore = score
+		trends[i].RankZ = rankZ
+		trends[i].ReviewZ = reviewZ
 	}
 
 	trends = sortTrends(trends)
 
-	themeScores := map[string]float64{}
-	themeCounts := map[string]int{}
-	for _, trend := range trends {
-		themeScores[trend.Theme] += trend.TrendScore
-		themeCounts[trend.Theme]++
+	latestIDs := make(map[string]bool, len(latestItems))
+	for _, item := range latestItems {
+		latestIDs[item.AppID] = true
 	}
-	for theme, total := range themeScores {
-		count := themeCounts[theme]
-		if count > 0 {
-			themeScores[theme] = total / float64(count)
+	var exits []AppExit
+	for _, item := range previousItems {
+		if latestIDs[item.AppID] {
+			continue
 		}
+		exits = append(exits, AppExit{
+			AppID:        item.AppID,
+			AppName:      item.AppName,
+			AppURL:       item.AppURL,
+			PreviousRank: item.Rank,
+			Theme:        classifier.ClassifyItem(item, cfg.Reclassify),
+			Genre:        primaryGenre(item),
+		})
+	}
+
+	var themeScores map[string]float64
+	if cfg.WeightedThemes {
+		themeScores = weightedThemeScores(trends)
+	} else {
+		themeScores = averageScoresBy(trends, func(trend AppTrend) string { return trend.Theme })
 	}
 
 	riskOnScore := averageThemes(themeScores, themes.RiskOn)
@@ -111,21 +277,163 @@ func AnalyzeTrends(latest store.Snapshot, previous store.Snapshot, latestItems,
 
 	return TrendResult{
 		Trends:        trends,
+		Exits:         exits,
+		Ignored:       ignored,
 		ThemeScores:   themeScores,
+		ThemeCounts:   themeCounts(trends, cfg.WeightedThemes),
 		RiskOnScore:   riskOnScore,
 		RiskOffScore:  riskOffScore,
 		RotationIndex: riskOnScore - riskOffScore,
+		Indexes:       ComputeCustomIndexes(themeScores, themes.Indexes),
+		Volatility:    volatility(trends, len(exits)),
 	}
 }
 
-func computeRatingDelta(current store.ChartItem, prev store.ChartItem, prevOk bool) int {
-	if !current.RatingCount.Valid {
-		return 0
+func volatility(trends []AppTrend, exits int) float64 {
+	var moved float64
+	var shared, entries int
+	for _, trend := range trends {
+		if trend.NewEntry {
+			entries++
+			continue
+		}
+		moved += math.Abs(float64(trend.RankDelta))
+		shared++
 	}
-	if prevOk && prev.RatingCount.Valid {
-		return current.RatingCount.Value - prev.RatingCount.Value
+	var mean float64
+	if shared > 0 {
+		mean = moved / float64(shared)
 	}
-	return current.RatingCount.Value
+	return mean + VolatilityChurnPenalty*float64(entries+exits)
+}
+
+// FilterIgnored splits items into those kept and the names of those matching
+// the config's ignore patterns.
+func FilterIgnored(items []store.ChartItem, themes ThemeConfig) ([]store.ChartItem, []string) {
+	if len(themes.IgnorePatterns) == 0 {
+		return items, nil
+	}
+	kept := make([]store.ChartItem, 0, len(items))
+	var ignored []string
+	for _, item := range items {
+		if themes.IsIgnored(item.AppName) {
+			ignored = append(ignored, item.AppName)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept, ignored
+}
+
+// GenreScores averages trend scores by raw App Store genre instead of theme.
+func GenreScores(trends []AppTrend) map[string]float64 {
+	return averageScoresBy(trends, func(trend AppTrend) string { return trend.Genre })
+}
+
+func averageScoresBy(trends []AppTrend, key func(AppTrend) string) map[string]float64 {
+	scores := map[string]float64{}
+	counts := map[string]int{}
+	for _, trend := range trends {
+		k := key(trend)
+		scores[k] += trend.TrendScore
+		counts[k]++
+	}
+	for k, total := range scores {
+		count := counts[k]
+		if count > 0 {
+			scores[k] = total / float64(count)
+		}
+	}
+	return scores
+}
+
+// weightedThemeScores averages trend scores per theme, counting each app by
+// its share in that theme.
+func weightedThemeScores(trends []AppTrend) map[string]float64 {
+	scores := map[string]float64{}
+	weights := map[string]float64{}
+	for _, trend := range trends {
+		for theme, weight := range trend.ThemeWeights {
+			scores[theme] += trend.TrendScore * weight
+			weights[theme] += weight
+		}
+	}
+	for theme, total := range scores {
+		if weights[theme] > 0 {
+			scores[theme] = total / weights[theme]
+		}
+	}
+	return scores
+}
+
+// themeCounts counts the apps scored in each theme.
+func themeCounts(trends []AppTrend, weighted bool) map[string]int {
+	counts := map[string]int{}
+	for _, trend := range trends {
+		if !weighted {
+			counts[trend.Theme]++
+			continue
+		}
+		for theme, weight := range trend.ThemeWeights {
+			if weight > 0 {
+				counts[theme]++
+			}
+		}
+	}
+	return counts
+}
+
+// gamesGenreID is the App Store's Games genre. Every game sits under it with
+// a sub-genre (7001 Action, 7012 Puzzle, ...), so it says nothing on its own.
+const gamesGenreID = "6014"
+
+// primaryGenre is the genre an item is grouped under for genre momentum: the
+// game sub-genre for games, otherwise the iTunes primary genre or the first
+// RSS genre.
+func primaryGenre(item store.ChartItem) string {
+	if sub := gameSubGenre(item); sub != "" {
+		return sub
+	}
+	if item.PrimaryGenre != "" {
+		return item.PrimaryGenre
+	}
+	if len(item.Genres) > 0 {
+		return item.Genres[0]
+	}
+	return "unknown"
+}
+
+// gameSubGenre returns the most specific genre of a game: the RSS genre
+// listed under Games, or else the first iTunes genre other than the
+// primary one. It returns "" for apps outside Games.
+func gameSubGenre(item store.ChartItem) string {
+	if !slices.Contains(item.GenreIDs, gamesGenreID) {
+		return ""
+	}
+	// Genres and GenreIDs line up unless the feed left a name or id blank.
+	if len(item.Genres) == len(item.GenreIDs) {
+		for i, id := range item.GenreIDs {
+			if id != gamesGenreID && strings.HasPrefix(id, "70") {
+				return item.Genres[i]
+			}
+		}
+	}
+	for _, genre := range item.ItunesGenres {
+		if genre != item.PrimaryGenre {
+			return genre
+		}
+	}
+	return ""
+}
+
+// computeRatingDelta returns the rating count growth and whether it is known.
+// A new entry has no earlier count to grow from, so its growth is unknown
+// rather than its whole rating total, which would dwarf every real delta.
+func computeRatingDelta(current store.ChartItem, prev store.ChartItem, prevOk bool) (int, bool) {
+	if !prevOk || !current.RatingCount.Valid || !prev.RatingCount.Valid {
+		return 0, false
+	}
+	return current.RatingCount.Value - prev.RatingCount.Value, true
 }
 
 func meanStd(values []float64) (float64, float64) {
@@ -146,6 +454,34 @@ func meanStd(values []float64) (float64, float64) {
 	return mean, math.Sqrt(variance)
 }
 
+// deltaScale maps a delta onto the configured score scale: a z-score, or a
+// percentile rank p (ties sharing their midpoint) centred as 2p-1 into
+// [-1, 1]. Both scales put a typical delta at 0, so the new entry bonus and
+// the thresholds applied to scores mean much the same under either.
+type deltaScale struct {
+	percentile bool
+	series     []float64
+	mean, std  float64
+}
+
+func newDeltaScale(method string, series []float64) deltaScale {
+	if method == ScorePercentile {
+		return deltaScale{percentile: true, series: series}
+	}
+	mean, std := meanStd(series)
+	return deltaScale{mean: mean, std: std}
+}
+
+func (d deltaScale) score(value float64) float64 {
+	if d.percentile {
+		if len(d.series) == 0 {
+			return 0
+		}
+		return 2*PercentileRank(value, d.series)/100 - 1
+	}
+	return zscore(value, d.mean, d.std)
+}
+
 func zscore(value, mean, std float64) float64 {
 	if std == 0 {
 		return 0
@@ -0,0 +1,197 @@
+package analysis
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"app_download_analyzer/internal/store"
+)
+
+// trendApp is one app in both test snapshots, at the same rank, with its
+// rating count in each; a negative count means the rating data is missing.
+type trendApp struct {
+	prevRatings, ratings int
+}
+
+func trendSnapshots(apps []trendApp) (store.Snapshot, store.Snapshot, []store.ChartItem, []store.ChartItem) {
+	at := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	previous := store.Snapshot{ID: 1, CollectedAt: at.AddDate(0, 0, -1), Country: "kr", Chart: "top-free", Limit: 100}
+	latest := store.Snapshot{ID: 2, CollectedAt: at, Country: "kr", Chart: "top-free", Limit: 100}
+	var prevItems, items []store.ChartItem
+	for i, app := range apps {
+		id := strconv.Itoa(i + 1)
+		prevItems = append(prevItems, store.ChartItem{Rank: i + 1, AppID: id, AppName: "App " + id, RatingCount: ratingCount(app.prevRatings)})
+		items = append(items, store.ChartItem{Rank: i + 1, AppID: id, AppName: "App " + id, RatingCount: ratingCount(app.ratings)})
+	}
+	return latest, previous, items, prevItems
+}
+
+func ratingCount(n int) store.NullInt {
+	if n < 0 {
+		return store.NullInt{}
+	}
+	return store.NullableInt(n)
+}
+
+func TestAnalyzeTrendsExcludesMissingRatings(t *testing.T) {
+	enriched := []trendApp{{100, 110}, {100, 120}, {100, 130}, {100, 140}}
+	tests := []struct {
+		name string
+		apps []trendApp
+		// Apps whose review z-score is above, below or (for unknown rating
+		// data) at the neutral point.
+		above, below, unknown int
+	}{
+		{"all enriched", enriched, 2, 2, 0},
+		{"unenriched latest", append(append([]trendApp{}, enriched...), trendApp{100, -1}, trendApp{100, -1}, trendApp{100, -1}, trendApp{100, -1}), 2, 2, 4},
+		{"unenriched previous", append(append([]trendApp{}, enriched...), trendApp{-1, 500}, trendApp{-1, 500}), 2, 2, 2},
+		{"nothing enriched", []trendApp{{-1, -1}, {-1, -1}}, 0, 0, 2},
+	}
+	// The enriched deltas are 10, 20, 30 and 40 whatever else is in the
+	// chart, so the biggest gainer always has the same z-score.
+	mean, std := meanStd([]float64{10, 20, 30, 40})
+	wantTopZ := (40 - mean) / std
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			latest, previous, items, prevItems := trendSnapshots(tt.apps)
+			result := AnalyzeTrends(latest, previous, items, prevItems, TrendConfig{ReviewWeight: 1}, defaultThemeConfig())
+
+			var above, below, unknown int
+			for _, trend := range result.Trends {
+				switch {
+				case trend.RatingDelta == nil:
+					unknown++
+					if trend.ReviewZ != 0 {
+						t.Errorf("app %s: ReviewZ = %v without rating data, want 0", trend.AppID, trend.ReviewZ)
+					}
+				case trend.ReviewZ > 0:
+					above++
+				case trend.ReviewZ < 0:
+					below++
+				}
+				if trend.AppID == "4" && math.Abs(trend.ReviewZ-wantTopZ) > 1e-9 {
+					t.Errorf("top gainer ReviewZ = %v, want %v", trend.ReviewZ, wantTopZ)
+				}
+			}
+			if above != tt.above || below != tt.below || unknown != tt.unknown {
+				t.Errorf("above/below/unknown = %d/%d/%d, want %d/%d/%d", above, below, unknown, tt.above, tt.below, tt.unknown)
+			}
+		})
+	}
+}
+
+func TestScoreMethodsRankAlike(t *testing.T) {
+	latest, previous, items, prevItems := trendSnapshots([]trendApp{{100, 110}, {100, 120}, {100, 130}, {100, 140}})
+	// A new entry without rating data scores only the new entry bonus, so
+	// where it lands shows whether the bonus weighs the same in both modes.
+	items = append(items, store.ChartItem{Rank: 5, AppID: "new", AppName: "Newcomer"})
+	want := []string{"4", "new", "3", "2", "1"}
+
+	for _, method := range []string{ScoreZScore, ScorePercentile} {
+		t.Run(method, func(t *testing.T) {
+			cfg := TrendConfig{ReviewWeight: 1, NewEntryBonus: 0.5, ScoreMethod: method}
+			result := AnalyzeTrends(latest, previous, items, prevItems, cfg, defaultThemeConfig())
+			var got []string
+			for _, trend := range result.Trends {
+				got = append(got, trend.AppID)
+				if trend.ReviewZ < -1.5 || trend.ReviewZ > 1.5 {
+					t.Errorf("app %s: ReviewZ = %v, want it near [-1, 1]", trend.AppID, trend.ReviewZ)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("ranking = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPercentileScoreIsCentred(t *testing.T) {
+	scale := newDeltaScale(ScorePercentile, []float64{10, 20, 30, 40, 1000})
+	tests := []struct {
+		value, want float64
+	}{
+		{10, -0.8},
+		{30, 0},
+		{1000, 0.8},
+		{5, -1},
+		{2000, 1},
+	}
+	for _, tt := range tests {
+		if got := scale.score(tt.value); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("score(%v) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+	if got := newDeltaScale(ScorePercentile, nil).score(10); got != 0 {
+		t.Errorf("score over an empty series = %v, want 0", got)
+	}
+}
+
+func TestAnalyzeTrendsGroupsGamesBySubGenre(t *testing.T) {
+	latest, previous, items, prevItems := trendSnapshots([]trendApp{{100, 110}, {100, 120}, {100, 130}, {100, 140}})
+	items[0].Genres, items[0].GenreIDs, items[0].PrimaryGenre = []string{"Games", "Puzzle"}, []string{"6014", "7012"}, "Games"
+	items[1].Genres, items[1].GenreIDs, items[1].PrimaryGenre = []string{"Games", "Action", "Entertainment"}, []string{"6014", "7001", "6016"}, "Games"
+	// Without a sub-genre in the feed, the iTunes genres name it.
+	items[2].Genres, items[2].GenreIDs = []string{"Games"}, []string{"6014"}
+	items[2].PrimaryGenre, items[2].ItunesGenres = "Games", []string{"Games", "Casual", "Entertainment"}
+	items[3].Genres, items[3].GenreIDs, items[3].PrimaryGenre = []string{"Photo & Video"}, []string{"6008"}, "Photo & Video"
+
+	result := AnalyzeTrends(latest, previous, items, prevItems, TrendConfig{ReviewWeight: 1}, defaultThemeConfig())
+	genres := map[string]string{}
+	for _, trend := range result.Trends {
+		genres[trend.AppID] = trend.Genre
+	}
+	want := map[string]string{"1": "Puzzle", "2": "Action", "3": "Casual", "4": "Photo & Video"}
+	for id, genre := range want {
+		if genres[id] != genre {
+			t.Errorf("app %s: Genre = %q, want %q", id, genres[id], genre)
+		}
+	}
+	if _, ok := GenreScores(result.Trends)["Games"]; ok {
+		t.Error("genre scores lump games together under Games")
+	}
+}
+
+func TestAnalyzeTrendsLeavesNewEntryGrowthUnknown(t *testing.T) {
+	latest, previous, items, prevItems := trendSnapshots([]trendApp{{100, 110}, {100, 120}, {100, 130}})
+	// App 4 enters the chart with a large rating total, none of it growth
+	// the previous snapshot saw.
+	items = append(items, store.ChartItem{Rank: 4, AppID: "4", AppName: "App 4", RatingCount: store.NullableInt(50000)})
+
+	result := AnalyzeTrends(latest, previous, items, prevItems, TrendConfig{ReviewWeight: 1}, defaultThemeConfig())
+	mean, std := meanStd([]float64{10, 20, 30})
+	for _, trend := range result.Trends {
+		switch trend.AppID {
+		case "4":
+			if !trend.NewEntry || trend.RatingDelta != nil || trend.ReviewZ != 0 {
+				t.Errorf("new entry: NewEntry %v, RatingDelta %v, ReviewZ %v; want true, nil, 0", trend.NewEntry, trend.RatingDelta, trend.ReviewZ)
+			}
+		case "3":
+			if want := (30 - mean) / std; math.Abs(trend.ReviewZ-want) > 1e-9 {
+				t.Errorf("top gainer ReviewZ = %v, want %v", trend.ReviewZ, want)
+			}
+		}
+	}
+}
+
+func TestNormalizePerDayOnlyAddsDisplayField(t *testing.T) {
+	latest, previous, items, prevItems := trendSnapshots([]trendApp{{100, 110}, {100, 120}, {100, 160}})
+	// The feeds were updated two days apart although the fetches ran one
+	// day apart.
+	previous.FeedUpdated = latest.CollectedAt.AddDate(0, 0, -2)
+	latest.FeedUpdated = latest.CollectedAt
+
+	plain := AnalyzeTrends(latest, previous, items, prevItems, TrendConfig{RankWeight: 1, ReviewWeight: 1}, defaultThemeConfig())
+	perDay := AnalyzeTrends(latest, previous, items, prevItems, TrendConfig{RankWeight: 1, ReviewWeight: 1, NormalizePerDay: true}, defaultThemeConfig())
+	for i, trend := range perDay.Trends {
+		if trend.TrendScore != plain.Trends[i].TrendScore || trend.ReviewZ != plain.Trends[i].ReviewZ {
+			t.Errorf("app %s: score %v, review z %v with per-day; want %v, %v as without", trend.AppID, trend.TrendScore, trend.ReviewZ, plain.Trends[i].TrendScore, plain.Trends[i].ReviewZ)
+		}
+		if trend.RatingDeltaPerDay == nil || *trend.RatingDeltaPerDay != float64(*trend.RatingDelta)/2 {
+			t.Errorf("app %s: RatingDeltaPerDay = %v, want half of %d", trend.AppID, trend.RatingDeltaPerDay, *trend.RatingDelta)
+		}
+	}
+}
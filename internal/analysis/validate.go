@@ -0,0 +1,118 @@
+package analysis
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ThemeConfigIssue is a problem ValidateThemeConfig found. Errors make
+// classification or scoring silently wrong; warnings are likely mistakes
+// that change nothing by themselves.
+type ThemeConfigIssue struct {
+	Warning bool
+	Message string
+}
+
+func (i ThemeConfigIssue) String() string {
+	if i.Warning {
+		return "warning: " + i.Message
+	}
+	return "error: " + i.Message
+}
+
+// ValidateThemeConfig checks a config for the mistakes hand edits tend to
+// make and ParseThemeConfig lets through: empty or repeated theme names,
+// risk-on/off and index entries naming no rule's theme, invalid patterns,
+// rules that can never match and an unknown ignore_stage. It returns every
+// issue found rather than stopping at the first.
+func ValidateThemeConfig(cfg ThemeConfig) []ThemeConfigIssue {
+	var issues []ThemeConfigIssue
+	errorf := func(format string, args ...any) {
+		issues = append(issues, ThemeConfigIssue{Message: fmt.Sprintf(format, args...)})
+	}
+	warnf := func(format string, args ...any) {
+		issues = append(issues, ThemeConfigIssue{Warning: true, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(cfg.Rules) == 0 {
+		warnf("no rules; the built-in default themes are used instead")
+	}
+	// Themes are keyed by their lowercased name once classified, so that is
+	// what risk lists and indexes have to match.
+	firstRule := map[string]int{}
+	for i, rule := range cfg.Rules {
+		n := i + 1
+		theme := strings.ToLower(strings.TrimSpace(rule.Theme))
+		label := fmt.Sprintf("rule %d (%s)", n, rule.Theme)
+		if theme == "" {
+			label = fmt.Sprintf("rule %d", n)
+			errorf("rule %d has an empty theme name", n)
+		} else if first, ok := firstRule[theme]; ok {
+			errorf("rule %d repeats theme %q from rule %d; merge them into one rule", n, theme, first)
+		} else {
+			firstRule[theme] = n
+		}
+		if len(normalizeList(rule.GenreIDs)) == 0 && len(normalizeList(rule.Genres)) == 0 &&
+			len(normalizeList(rule.Keywords)) == 0 && len(rule.Patterns) == 0 {
+			warnf("%s has no genre_ids, genres, keywords or patterns and never matches", label)
+		}
+		for _, pattern := range rule.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				errorf("%s: invalid pattern %q: %v", label, pattern, err)
+			}
+		}
+	}
+
+	known := func(theme string) bool {
+		_, ok := firstRule[theme]
+		return ok || theme == "other"
+	}
+	unknownTheme := func(where, theme string) {
+		if lower := strings.ToLower(strings.TrimSpace(theme)); lower != theme && known(lower) {
+			errorf("%s: %q never matches; theme names are lowercase, write %q", where, theme, lower)
+			return
+		}
+		errorf("%s: %q is not the theme of any rule", where, theme)
+	}
+	riskOn := map[string]bool{}
+	for _, theme := range cfg.RiskOn {
+		if !known(theme) {
+			unknownTheme("risk_on", theme)
+		}
+		riskOn[theme] = true
+	}
+	for _, theme := range cfg.RiskOff {
+		if !known(theme) {
+			unknownTheme("risk_off", theme)
+		}
+		if riskOn[theme] {
+			warnf("%q is in both risk_on and risk_off", theme)
+		}
+	}
+	names := make([]string, 0, len(cfg.Indexes))
+	for name := range cfg.Indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		themes := make([]string, 0, len(cfg.Indexes[name]))
+		for theme := range cfg.Indexes[name] {
+			themes = append(themes, theme)
+		}
+		sort.Strings(themes)
+		for _, theme := range themes {
+			if !known(theme) {
+				unknownTheme(fmt.Sprintf("index %q", name), theme)
+			}
+		}
+	}
+
+	switch cfg.IgnoreStage {
+	case "", IgnoreAtAnalyze, IgnoreAtFetch:
+	default:
+		errorf("ignore_stage %q is neither %q nor %q, so ignore_patterns never apply", cfg.IgnoreStage, IgnoreAtAnalyze, IgnoreAtFetch)
+	}
+	return issues
+}
@@ -0,0 +1,20 @@
+package apple
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// artworkSizePattern matches the size segment ending an App Store artwork
+// URL, e.g. "/100x100bb.png", keeping the crop suffix and extension.
+var artworkSizePattern = regexp.MustCompile(`/\d+x\d+([a-z]*)(\.[a-z]+)$`)
+
+// ArtworkURL rewrites an artwork URL, such as the feed's artworkUrl100, to
+// request a size x size image. URLs without the expected size segment, and
+// sizes below 1, return base unchanged.
+func ArtworkURL(base string, size int) string {
+	if size < 1 || !artworkSizePattern.MatchString(base) {
+		return base
+	}
+	return artworkSizePattern.ReplaceAllString(base, fmt.Sprintf("/%dx%d${1}${2}", size, size))
+}
@@ -0,0 +1,67 @@
+package apple
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultRSSBaseURL is the Apple marketing tools RSS endpoint.
+	DefaultRSSBaseURL = "https://rss.marketingtools.apple.com/api/v2"
+	// DefaultItunesBaseURL is the iTunes Search API endpoint.
+	DefaultItunesBaseURL = "https://itunes.apple.com"
+)
+
+// Client talks to the Apple RSS and iTunes endpoints. The base URLs can be
+// pointed at a mirror or a local test server.
+type Client struct {
+	HTTP          *http.Client
+	RSSBaseURL    string
+	ItunesBaseURL string
+	// LookupConcurrency is how many iTunes lookup requests LookupApps runs
+	// at once; values below 1 mean one.
+	LookupConcurrency int
+	// Limiter, when set, paces every iTunes lookup request made through
+	// the client.
+	Limiter *RateLimiter
+	// LookupDelay is the pause between starting consecutive lookup
+	// requests within one LookupApps call.
+	LookupDelay time.Duration
+	// Lang, when set, asks iTunes lookups for results in that language
+	// (e.g. "en_us") instead of the storefront's default.
+	Lang string
+}
+
+// NewClient returns a Client using the default Apple endpoints. A nil
+// httpClient falls back to http.DefaultClient.
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		HTTP:          httpClient,
+		RSSBaseURL:    DefaultRSSBaseURL,
+		ItunesBaseURL: DefaultItunesBaseURL,
+	}
+}
+
+// FetchTopChart fetches a chart with the default endpoints.
+func FetchTopChart(ctx context.Context, client *http.Client, country, chart string, limit int) (RSSResponse, string, error) {
+	return NewClient(client).FetchTopChart(ctx, country, chart, limit)
+}
+
+// FetchGenreChart fetches a genre-scoped chart with the default endpoints.
+func FetchGenreChart(ctx context.Context, client *http.Client, country, chart, genre string, limit int) (RSSResponse, string, error) {
+	return NewClient(client).FetchGenreChart(ctx, country, chart, genre, limit)
+}
+
+// LookupApp looks up a single app with the default endpoints.
+func LookupApp(ctx context.Context, client *http.Client, appID, country string) (ItunesApp, bool, error) {
+	return NewClient(client).LookupApp(ctx, appID, country)
+}
+
+// LookupApps looks up many apps with the default endpoints.
+func LookupApps(ctx context.Context, client *http.Client, ids []string, country string) (map[string]ItunesApp, error) {
+	return NewClient(client).LookupApps(ctx, ids, country)
+}
@@ -0,0 +1,115 @@
+package apple
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"app_download_analyzer/internal/version"
+)
+
+const (
+	userAgent     = version.String
+	maxAttempts   = 3
+	maxRetryAfter = 30 * time.Second
+)
+
+// getJSON fetches url and decodes a 200 response into out. Network errors,
+// 5xx and 429 responses are retried with a growing backoff, using the
+// server's Retry-After on 429 when present. Other statuses are returned at
+// once as the error built by statusErr.
+func getJSON(ctx context.Context, client *http.Client, url string, statusErr func(*http.Response) error, out any) error {
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", userAgent)
+
+		wait := time.Duration(500*(attempt+1)) * time.Millisecond
+		res, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+		} else {
+			retry, delay, err := readResponse(res, statusErr, out)
+			if err == nil {
+				return nil
+			}
+			lastErr = err
+			if !retry {
+				return err
+			}
+			if delay > 0 {
+				wait = delay
+			}
+		}
+
+		if attempt < maxAttempts-1 {
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
+		}
+	}
+	return lastErr
+}
+
+// sleep waits between attempts, returning early with ctx's error. Tests
+// replace it to record the waits instead of sitting through them.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// now is the clock Retry-After dates are measured against; tests pin it.
+var now = time.Now
+
+// readResponse decodes res into out, reporting whether a failure is worth
+// retrying and any server-requested delay.
+func readResponse(res *http.Response, statusErr func(*http.Response) error, out any) (bool, time.Duration, error) {
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		retry := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+		var delay time.Duration
+		if res.StatusCode == http.StatusTooManyRequests {
+			delay = parseRetryAfter(res.Header.Get("Retry-After"), now())
+		}
+		return retry, delay, statusErr(res)
+	}
+	return false, 0, json.NewDecoder(res.Body).Decode(out)
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as
+// an HTTP-date, capped at maxRetryAfter. It returns 0 when the header is
+// absent or malformed so the caller falls back to its own backoff.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		delay = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		delay = at.Sub(now)
+		if delay <= 0 {
+			return 0
+		}
+	} else {
+		return 0
+	}
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	}
+	return delay
+}
@@ -0,0 +1,54 @@
+package apple
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetJSONHonorsRetryAfter(t *testing.T) {
+	clock := time.Date(2024, 1, 15, 9, 30, 0, 0, time.UTC)
+	orig := now
+	now = func() time.Time { return clock }
+	t.Cleanup(func() { now = orig })
+
+	tests := []struct {
+		name       string
+		retryAfter string
+		wantWait   time.Duration
+	}{
+		{"seconds", "2", 2 * time.Second},
+		{"http date", clock.Add(5 * time.Second).Format(http.TimeFormat), 5 * time.Second},
+		{"capped", "3600", maxRetryAfter},
+		{"malformed falls back to backoff", "soon", 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waits := recordSleeps(t)
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if hits.Add(1) == 1 {
+					w.Header().Set("Retry-After", tt.retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				fmt.Fprint(w, testFeed)
+			}))
+			defer srv.Close()
+			var out RSSResponse
+			if err := getJSON(context.Background(), srv.Client(), srv.URL, rssStatusError, &out); err != nil {
+				t.Fatalf("getJSON: %v", err)
+			}
+			if got := hits.Load(); got != 2 {
+				t.Errorf("server hit %d times, want 2", got)
+			}
+			if len(*waits) != 1 || (*waits)[0] != tt.wantWait {
+				t.Errorf("waits = %v, want [%v]", *waits, tt.wantWait)
+			}
+		})
+	}
+}
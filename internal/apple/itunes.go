@@ -2,9 +2,22 @@ package apple
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrRateLimited is returned when iTunes throttles a lookup (403/429); the
+	// request may succeed if retried later.
+	ErrRateLimited = errors.New("itunes rate limited")
+	// ErrNotFound is returned when the app is not available in the storefront.
+	ErrNotFound = errors.New("itunes app not found")
 )
 
 type ItunesResponse struct {
@@ -25,28 +38,106 @@ type ItunesApp struct {
 	AverageUserRatingForCurrentVersion float64  `json:"averageUserRatingForCurrentVersion"`
 }
 
-func LookupApp(ctx context.Context, client *http.Client, appID, country string) (ItunesApp, bool, error) {
-	var resp ItunesResponse
-	url := fmt.Sprintf("https://itunes.apple.com/lookup?id=%s&country=%s", appID, country)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return ItunesApp{}, false, err
-	}
-	req.Header.Set("User-Agent", "app_download_analyzer/1.0")
+// lookupBatchSize is the number of ids sent per lookup request; the iTunes
+// API accepts roughly 200 comma-separated ids.
+const lookupBatchSize = 150
 
-	res, err := client.Do(req)
+func (c *Client) LookupApp(ctx context.Context, appID, country string) (ItunesApp, bool, error) {
+	resp, err := c.lookup(ctx, []string{appID}, country)
 	if err != nil {
 		return ItunesApp{}, false, err
 	}
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
-		return ItunesApp{}, false, fmt.Errorf("itunes request failed: %s", res.Status)
-	}
-	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
-		return ItunesApp{}, false, err
-	}
 	if resp.ResultCount < 1 || len(resp.Results) == 0 {
 		return ItunesApp{}, false, nil
 	}
 	return resp.Results[0], true, nil
 }
+
+// LookupApps looks up many apps in as few requests as possible, returning
+// the results keyed by app id. Apps not found in the storefront are absent
+// from the map. Requests run on up to LookupConcurrency workers, started at
+// least LookupDelay apart; a failed request does not stop the others, and
+// its error is returned joined with any others alongside everything that
+// was found.
+func (c *Client) LookupApps(ctx context.Context, ids []string, country string) (map[string]ItunesApp, error) {
+	var batches [][]string
+	for start := 0; start < len(ids); start += lookupBatchSize {
+		end := start + lookupBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batches = append(batches, ids[start:end])
+	}
+
+	workers := c.LookupConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(batches) {
+		workers = len(batches)
+	}
+	responses := make([]ItunesResponse, len(batches))
+	errs := make([]error, len(batches))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				responses[i], errs[i] = c.lookup(ctx, batches[i], country)
+			}
+		}()
+	}
+	for i := range batches {
+		if i > 0 && c.LookupDelay > 0 {
+			select {
+			case <-time.After(c.LookupDelay):
+			case <-ctx.Done():
+			}
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Merge in batch order so the result doesn't depend on scheduling.
+	apps := make(map[string]ItunesApp, len(ids))
+	var failed []error
+	for i, resp := range responses {
+		if err := errs[i]; err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				failed = append(failed, fmt.Errorf("lookup of %d apps from %s: %w", len(batches[i]), batches[i][0], err))
+			}
+			continue
+		}
+		for _, app := range resp.Results {
+			apps[strconv.FormatInt(app.TrackID, 10)] = app
+		}
+	}
+	return apps, errors.Join(failed...)
+}
+
+func (c *Client) lookup(ctx context.Context, ids []string, country string) (ItunesResponse, error) {
+	var resp ItunesResponse
+	if err := c.Limiter.Wait(ctx); err != nil {
+		return resp, err
+	}
+	lookupURL := fmt.Sprintf("%s/lookup?id=%s&country=%s", c.ItunesBaseURL, strings.Join(ids, ","), country)
+	if c.Lang != "" {
+		lookupURL += "&lang=" + url.QueryEscape(c.Lang)
+	}
+	err := getJSON(ctx, c.HTTP, lookupURL, itunesStatusError, &resp)
+	return resp, err
+}
+
+func itunesStatusError(res *http.Response) error {
+	switch res.StatusCode {
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s", ErrRateLimited, res.Status)
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, res.Status)
+	default:
+		return fmt.Errorf("itunes request failed: %s", res.Status)
+	}
+}
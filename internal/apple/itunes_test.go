@@ -0,0 +1,143 @@
+package apple
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// lookupServer answers /lookup with one result per requested id, except ids
+// in missing, and fails whole requests whose first id is in failing.
+func lookupServer(t *testing.T, missing, failing map[string]bool, handle func(ids []string)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/lookup" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		ids := strings.Split(r.URL.Query().Get("id"), ",")
+		if handle != nil {
+			handle(ids)
+		}
+		if failing[ids[0]] {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var results []string
+		for _, id := range ids {
+			if !missing[id] {
+				results = append(results, fmt.Sprintf(`{"trackId":%s,"trackName":"App %s","userRatingCount":%s}`, id, id, id))
+			}
+		}
+		fmt.Fprintf(w, `{"resultCount":%d,"results":[%s]}`, len(results), strings.Join(results, ","))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func appIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i + 1)
+	}
+	return ids
+}
+
+func TestLookupAppsBatches(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	srv := lookupServer(t, map[string]bool{"7": true}, nil, func(ids []string) {
+		mu.Lock()
+		sizes = append(sizes, len(ids))
+		mu.Unlock()
+	})
+	client := NewClient(srv.Client())
+	client.ItunesBaseURL = srv.URL
+	client.LookupConcurrency = 2
+
+	apps, err := client.LookupApps(context.Background(), appIDs(400), "kr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(sizes)
+	if fmt.Sprint(sizes) != "[100 150 150]" {
+		t.Errorf("batch sizes = %v, want [100 150 150]", sizes)
+	}
+	if len(apps) != 399 {
+		t.Errorf("got %d apps, want 399 (one missing from the storefront)", len(apps))
+	}
+	if _, ok := apps["7"]; ok {
+		t.Error("missing app 7 is in the result")
+	}
+	if app := apps["400"]; app.TrackName != "App 400" || app.UserRatingCount != 400 {
+		t.Errorf("app 400 = %+v", app)
+	}
+}
+
+func TestLookupAppsBoundsConcurrency(t *testing.T) {
+	var inflight, peak atomic.Int32
+	srv := lookupServer(t, nil, nil, func([]string) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	})
+	client := NewClient(srv.Client())
+	client.ItunesBaseURL = srv.URL
+	client.LookupConcurrency = 2
+
+	if _, err := client.LookupApps(context.Background(), appIDs(6*lookupBatchSize), "kr"); err != nil {
+		t.Fatal(err)
+	}
+	if got := peak.Load(); got > 2 {
+		t.Errorf("peak concurrent requests = %d, want at most 2", got)
+	}
+}
+
+func TestLookupAppsKeepsOtherBatchesOnFailure(t *testing.T) {
+	// The second batch starts at id 151 and is rejected; the others still
+	// count.
+	srv := lookupServer(t, nil, map[string]bool{"151": true}, nil)
+	client := NewClient(srv.Client())
+	client.ItunesBaseURL = srv.URL
+	client.LookupConcurrency = 3
+
+	apps, err := client.LookupApps(context.Background(), appIDs(400), "kr")
+	if err == nil || !strings.Contains(err.Error(), "lookup of 150 apps from 151") {
+		t.Errorf("err = %v, want the failed batch named", err)
+	}
+	if len(apps) != 250 {
+		t.Errorf("got %d apps, want the 250 from the batches that succeeded", len(apps))
+	}
+}
+
+func TestLookupAppSendsLanguage(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		fmt.Fprint(w, `{"resultCount":0,"results":[]}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.Client())
+	client.ItunesBaseURL = srv.URL
+	client.Lang = "en_us"
+
+	_, found, err := client.LookupApp(context.Background(), "42", "jp")
+	if err != nil || found {
+		t.Fatalf("LookupApp = found %v, err %v; want not found", found, err)
+	}
+	if query != "id=42&country=jp&lang=en_us" {
+		t.Errorf("query = %s", query)
+	}
+}
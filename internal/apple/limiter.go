@@ -0,0 +1,73 @@
+package apple
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultLookupsPerMinute stays under the roughly 20 calls per minute the
+// iTunes Search API allows per client.
+const DefaultLookupsPerMinute = 20
+
+// RateLimiter is a token bucket shared by every goroutine making requests
+// through a Client: up to burst requests go out at once, then one more each
+// time a token refills. A nil *RateLimiter never waits.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewRateLimiter allows perMinute requests per minute with bursts of up to
+// burst requests. It returns nil, meaning no limit, when perMinute <= 0.
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		interval: time.Minute / time.Duration(perMinute),
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// Wait blocks until a request may be made or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	// Taking the token up front, even into debt, queues concurrent callers
+	// one interval apart.
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens * float64(l.interval))
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
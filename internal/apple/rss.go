@@ -2,18 +2,20 @@ package apple
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 )
 
-var validCharts = map[string]bool{
-	"top-free": true,
-	"top-paid": true,
-}
+// charts are the RSS charts the client can fetch.
+var charts = []string{"top-free", "top-paid", "top-grossing", "new-apps-we-love", "new-games-we-love"}
 
-const rssBaseURL = "https://rss.marketingtools.apple.com/api/v2"
+// ErrFeedNotFound is returned when the RSS endpoint answers 404 or 410,
+// typically for an unknown storefront country or chart.
+var ErrFeedNotFound = errors.New("rss feed not found")
 
 type RSSResponse struct {
 	Feed RSSFeed `json:"feed"`
@@ -27,6 +29,17 @@ type RSSFeed struct {
 	Links   []RSSLink `json:"links"`
 }
 
+// UpdatedTime parses the feed's "updated" field, reporting false when it is
+// missing or in an unrecognised format.
+func (f RSSFeed) UpdatedTime() (time.Time, bool) {
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, time.RFC3339} {
+		if t, err := time.Parse(layout, f.Updated); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
 type RSSLink struct {
 	Self string `json:"self"`
 }
@@ -49,57 +62,68 @@ type RSSGenre struct {
 }
 
 func ValidChart(chart string) bool {
-	return validCharts[chart]
+	return slices.Contains(charts, chart)
 }
 
-func FetchTopChart(ctx context.Context, client *http.Client, country, chart string, limit int) (RSSResponse, string, error) {
-	var resp RSSResponse
-	if !ValidChart(chart) {
-		return resp, "", fmt.Errorf("invalid chart: %s", chart)
+// Charts returns the supported chart names.
+func Charts() []string {
+	return slices.Clone(charts)
+}
+
+// CheckChart returns an error naming the supported charts when chart is not
+// one of them.
+func CheckChart(chart string) error {
+	if ValidChart(chart) {
+		return nil
 	}
-	url := fmt.Sprintf("%s/%s/apps/%s/%d/apps.json", rssBaseURL, country, chart, limit)
-	var lastErr error
-	for attempt := 0; attempt < 3; attempt++ {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-		if err != nil {
-			return resp, "", err
-		}
-		req.Header.Set("User-Agent", "app_download_analyzer/1.0")
-
-		res, err := client.Do(req)
-		if err != nil {
-			lastErr = err
-		} else {
-			func() {
-				defer res.Body.Close()
-				if res.StatusCode != http.StatusOK {
-					lastErr = fmt.Errorf("rss request failed: %s", res.Status)
-					return
-				}
-				if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
-					lastErr = err
-					return
-				}
-				lastErr = nil
-			}()
-			if lastErr == nil {
-				return resp, url, nil
-			}
-			if res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
-				return resp, "", lastErr
-			}
-		}
+	return fmt.Errorf("unsupported chart %q (want one of %s)", chart, strings.Join(charts, ", "))
+}
 
-		if attempt < 2 {
-			select {
-			case <-time.After(time.Duration(500*(attempt+1)) * time.Millisecond):
-			case <-ctx.Done():
-				return resp, "", ctx.Err()
-			}
+// ValidGenreID reports whether genre looks like an App Store genre id such
+// as 6014 (Games).
+func ValidGenreID(genre string) bool {
+	if genre == "" {
+		return false
+	}
+	for _, r := range genre {
+		if r < '0' || r > '9' {
+			return false
 		}
 	}
+	return true
+}
+
+func (c *Client) FetchTopChart(ctx context.Context, country, chart string, limit int) (RSSResponse, string, error) {
+	return c.FetchGenreChart(ctx, country, chart, "", limit)
+}
 
-	return resp, "", lastErr
+// FetchGenreChart fetches a chart scoped to one genre id, e.g. only games in
+// top-free. An empty genre fetches the overall chart.
+func (c *Client) FetchGenreChart(ctx context.Context, country, chart, genre string, limit int) (RSSResponse, string, error) {
+	var resp RSSResponse
+	if err := CheckChart(chart); err != nil {
+		return resp, "", err
+	}
+	if genre != "" && !ValidGenreID(genre) {
+		return resp, "", fmt.Errorf("invalid genre id: %s", genre)
+	}
+	url := fmt.Sprintf("%s/%s/apps/%s/%d/apps.json", c.RSSBaseURL, country, chart, limit)
+	if genre != "" {
+		url += "?genre=" + genre
+	}
+	if err := getJSON(ctx, c.HTTP, url, rssStatusError, &resp); err != nil {
+		return resp, "", err
+	}
+	return resp, url, nil
+}
+
+func rssStatusError(res *http.Response) error {
+	switch res.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return fmt.Errorf("%w: %s", ErrFeedNotFound, res.Status)
+	default:
+		return fmt.Errorf("rss request failed: %s", res.Status)
+	}
 }
 
 func ExtractGenres(genres []RSSGenre) ([]string, []string) {
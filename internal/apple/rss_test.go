@@ -0,0 +1,169 @@
+package apple
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordSleeps replaces sleep for the test, returning the waits asked for.
+func recordSleeps(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var waits []time.Duration
+	orig := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return ctx.Err()
+	}
+	t.Cleanup(func() { sleep = orig })
+	return &waits
+}
+
+const testFeed = `{"feed":{"title":"Top Free Apps","country":"kr","updated":"Mon, 15 Jan 2024 09:30:00 +0000","results":[
+	{"id":"111","name":"Alpha","artistName":"A Corp","releaseDate":"2023-12-01","artworkUrl100":"https://example.com/a/100x100bb.png","url":"https://apps.apple.com/app/id111","genres":[{"genreId":"6014","name":"Games"},{"genreId":"7001","name":"Action"}]},
+	{"id":"222","name":"Beta","genres":[]}
+]}}`
+
+func TestFetchTopChartParsesFeed(t *testing.T) {
+	var gotPath, gotGenre, gotUA string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotGenre, gotUA = r.URL.Path, r.URL.Query().Get("genre"), r.UserAgent()
+		fmt.Fprint(w, testFeed)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.Client())
+	client.RSSBaseURL = srv.URL
+
+	resp, url, err := client.FetchGenreChart(context.Background(), "kr", "top-free", "6014", 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/kr/apps/top-free/25/apps.json" || gotGenre != "6014" {
+		t.Errorf("requested %s?genre=%s", gotPath, gotGenre)
+	}
+	if want := srv.URL + "/kr/apps/top-free/25/apps.json?genre=6014"; url != want {
+		t.Errorf("url = %s, want %s", url, want)
+	}
+	if gotUA != userAgent {
+		t.Errorf("User-Agent = %q, want %q", gotUA, userAgent)
+	}
+	if len(resp.Feed.Results) != 2 {
+		t.Fatalf("got %d results, want 2", len(resp.Feed.Results))
+	}
+	app := resp.Feed.Results[0]
+	if app.ID != "111" || app.Name != "Alpha" || app.ArtistName != "A Corp" || app.ReleaseDate != "2023-12-01" {
+		t.Errorf("first result = %+v", app)
+	}
+	names, ids := ExtractGenres(app.Genres)
+	if fmt.Sprint(names) != "[Games Action]" || fmt.Sprint(ids) != "[6014 7001]" {
+		t.Errorf("genres = %v %v", names, ids)
+	}
+	updated, ok := resp.Feed.UpdatedTime()
+	if !ok || !updated.Equal(time.Date(2024, 1, 15, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("UpdatedTime = %v, %v", updated, ok)
+	}
+}
+
+func TestFetchTopChartRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int // response per attempt; the last one repeats
+		wantErr  error // nil for success
+		wantHits int32
+	}{
+		{"5xx then success", []int{http.StatusInternalServerError, http.StatusOK}, nil, 2},
+		{"not found fails at once", []int{http.StatusNotFound}, ErrFeedNotFound, 1},
+		{"persistent 429 exhausts attempts", []int{http.StatusTooManyRequests}, errAny, maxAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waits := recordSleeps(t)
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(hits.Add(1)) - 1
+				if n >= len(tt.statuses) {
+					n = len(tt.statuses) - 1
+				}
+				if status := tt.statuses[n]; status != http.StatusOK {
+					w.WriteHeader(status)
+					return
+				}
+				fmt.Fprint(w, testFeed)
+			}))
+			defer srv.Close()
+			client := NewClient(srv.Client())
+			client.RSSBaseURL = srv.URL
+
+			resp, _, err := client.FetchTopChart(context.Background(), "kr", "top-free", 25)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr == nil && len(resp.Feed.Results) != 2:
+				t.Errorf("got %d results after retry, want 2", len(resp.Feed.Results))
+			case tt.wantErr == errAny && err == nil:
+				t.Fatal("expected an error")
+			case tt.wantErr != nil && tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := hits.Load(); got != tt.wantHits {
+				t.Errorf("server hit %d times, want %d", got, tt.wantHits)
+			}
+			if got, want := len(*waits), int(tt.wantHits)-1; got != want {
+				t.Errorf("slept %d times, want %d", got, want)
+			}
+		})
+	}
+}
+
+// errAny marks a test case that expects some error without naming it.
+var errAny = errors.New("any error")
+
+func TestRSSStatusError(t *testing.T) {
+	tests := []struct {
+		status   int
+		notFound bool
+	}{
+		{http.StatusNotFound, true},
+		{http.StatusGone, true},
+		{http.StatusBadRequest, false},
+		{http.StatusForbidden, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		res := &http.Response{StatusCode: tt.status, Status: fmt.Sprintf("%d %s", tt.status, http.StatusText(tt.status))}
+		if got := errors.Is(rssStatusError(res), ErrFeedNotFound); got != tt.notFound {
+			t.Errorf("status %d: ErrFeedNotFound = %v, want %v", tt.status, got, tt.notFound)
+		}
+	}
+}
+
+func TestCheckChart(t *testing.T) {
+	for _, chart := range []string{"top-free", "top-paid", "top-grossing", "new-apps-we-love", "new-games-we-love"} {
+		if !ValidChart(chart) {
+			t.Errorf("ValidChart(%q) = false, want true", chart)
+		}
+		if err := CheckChart(chart); err != nil {
+			t.Errorf("CheckChart(%q) = %v", chart, err)
+		}
+	}
+
+	err := CheckChart("top-expensive")
+	if err == nil {
+		t.Fatal("CheckChart accepted an unknown chart")
+	}
+	for _, chart := range Charts() {
+		if !strings.Contains(err.Error(), chart) {
+			t.Errorf("error %q does not name supported chart %q", err, chart)
+		}
+	}
+	if _, _, err := NewClient(nil).FetchTopChart(context.Background(), "kr", "top-expensive", 10); err == nil {
+		t.Error("FetchTopChart accepted an unknown chart")
+	}
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// The methods below are the original context-free API, kept for callers that
+// have no request or deadline to pass. Each runs its ...Context counterpart
+// with context.Background().
+
+func (s *Store) InsertSnapshot(snapshot Snapshot) (int64, error) {
+	return s.InsertSnapshotContext(context.Background(), snapshot)
+}
+
+func (s *Store) InsertSnapshotWithItems(snapshot Snapshot, items []ChartItem) (int64, error) {
+	return s.InsertSnapshotWithItemsContext(context.Background(), snapshot, items)
+}
+
+func (s *Store) SaveThemeConfig(content []byte) (int64, error) {
+	return s.SaveThemeConfigContext(context.Background(), content)
+}
+
+func (s *Store) GetThemeConfig(id int64) (ThemeConfigRecord, error) {
+	return s.GetThemeConfigContext(context.Background(), id)
+}
+
+func (s *Store) InsertChartItem(item ChartItem) error {
+	return s.InsertChartItemContext(context.Background(), item)
+}
+
+func (s *Store) InsertChartItems(snapshotID int64, items []ChartItem) error {
+	return s.InsertChartItemsContext(context.Background(), snapshotID, items)
+}
+
+func (s *Store) DeleteSnapshot(id int64) error {
+	return s.DeleteSnapshotContext(context.Background(), id)
+}
+
+func (s *Store) UpdateChartItemEnrichment(item ChartItem) error {
+	return s.UpdateChartItemEnrichmentContext(context.Background(), item)
+}
+
+func (s *Store) GetSnapshotByID(id int64) (Snapshot, error) {
+	return s.GetSnapshotByIDContext(context.Background(), id)
+}
+
+func (s *Store) GetLatestSnapshot(country, chart string) (Snapshot, error) {
+	return s.GetLatestSnapshotContext(context.Background(), country, chart)
+}
+
+func (s *Store) GetSnapshotAsOf(country, chart string, at time.Time) (Snapshot, error) {
+	return s.GetSnapshotAsOfContext(context.Background(), country, chart, at)
+}
+
+func (s *Store) GetPreviousSnapshot(country, chart string, before time.Time) (Snapshot, error) {
+	return s.GetPreviousSnapshotContext(context.Background(), country, chart, before)
+}
+
+func (s *Store) GetSnapshotNearestTime(country, chart string, target time.Time) (Snapshot, error) {
+	return s.GetSnapshotNearestTimeContext(context.Background(), country, chart, target)
+}
+
+func (s *Store) SnapshotExistsWithin(country, chart string, t time.Time, window time.Duration) (bool, int64, error) {
+	return s.SnapshotExistsWithinContext(context.Background(), country, chart, t, window)
+}
+
+func (s *Store) GetSnapshotItems(snapshotID int64) ([]ChartItem, error) {
+	return s.GetSnapshotItemsContext(context.Background(), snapshotID)
+}
+
+func (s *Store) EachChartItem(country, chart string, since, until time.Time, fn func(Snapshot, ChartItem) error) error {
+	return s.EachChartItemContext(context.Background(), country, chart, since, until, fn)
+}
+
+func (s *Store) ListSnapshots(country, chart string) ([]Snapshot, error) {
+	return s.ListSnapshotsContext(context.Background(), country, chart)
+}
+
+func (s *Store) ListRecentSnapshots(country, chart string, n int) ([]Snapshot, error) {
+	return s.ListRecentSnapshotsContext(context.Background(), country, chart, n)
+}
+
+func (s *Store) ListSnapshotSummaries(country, chart string, limit int) ([]SnapshotSummary, error) {
+	return s.ListSnapshotSummariesContext(context.Background(), country, chart, limit)
+}
+
+func (s *Store) DeleteSnapshotsOlderThan(country, chart string, cutoff time.Time, dryRun bool) ([]Snapshot, error) {
+	return s.DeleteSnapshotsOlderThanContext(context.Background(), country, chart, cutoff, dryRun)
+}
+
+func (s *Store) DeleteSnapshotsKeepingLast(country, chart string, keep int, dryRun bool) ([]Snapshot, error) {
+	return s.DeleteSnapshotsKeepingLastContext(context.Background(), country, chart, keep, dryRun)
+}
+
+func (s *Store) CountSnapshots(country, chart string) (int, error) {
+	return s.CountSnapshotsContext(context.Background(), country, chart)
+}
+
+func (s *Store) ReplaceSnapshotThemes(snapshotID, themeConfigID int64, themes map[string]string) error {
+	return s.ReplaceSnapshotThemesContext(context.Background(), snapshotID, themeConfigID, themes)
+}
+
+func (s *Store) CompareSnapshots(fromID, toID int64) (SnapshotDiff, error) {
+	return s.CompareSnapshotsContext(context.Background(), fromID, toID)
+}
+
+func (s *Store) ListSnapshotsBetween(country, chart string, since, until time.Time) ([]Snapshot, error) {
+	return s.ListSnapshotsBetweenContext(context.Background(), country, chart, since, until)
+}
+
+func (s *Store) ImportSnapshots(snapshots []ImportedSnapshot, overwrite bool) (ImportResult, error) {
+	return s.ImportSnapshotsContext(context.Background(), snapshots, overwrite)
+}
+
+func (s *Store) SnapshotIntegrity(country, chart string) ([]SnapshotIntegrity, error) {
+	return s.SnapshotIntegrityContext(context.Background(), country, chart)
+}
+
+func (s *Store) GetSnapshotItemsPaged(snapshotID int64, limit, offset int) ([]ChartItem, int, error) {
+	return s.GetSnapshotItemsPagedContext(context.Background(), snapshotID, limit, offset)
+}
+
+func (s *Store) ListSnapshotSummariesPaged(country, chart string, limit, offset int) ([]SnapshotSummary, int, error) {
+	return s.ListSnapshotSummariesPagedContext(context.Background(), country, chart, limit, offset)
+}
+
+func (s *Store) GetAppHistory(country, chart, appID string) ([]AppHistoryPoint, error) {
+	return s.GetAppHistoryContext(context.Background(), country, chart, appID)
+}
+
+func (s *Store) SetSnapshotTag(id int64, tag string) error {
+	return s.SetSnapshotTagContext(context.Background(), id, tag)
+}
+
+func (s *Store) ListSnapshotsByTag(country, chart, tag string) ([]SnapshotSummary, error) {
+	return s.ListSnapshotsByTagContext(context.Background(), country, chart, tag)
+}
+
+func (s *Store) SnapshotChecksum(id int64) (string, error) {
+	return s.SnapshotChecksumContext(context.Background(), id)
+}
@@ -0,0 +1,83 @@
+package store
+
+import "context"
+
+// SnapshotDiff is the data-level difference between two snapshots, with no
+// scoring applied.
+type SnapshotDiff struct {
+	FromID int64 `json:"from_id"`
+	ToID   int64 `json:"to_id"`
+	// Entrants are apps only in the "to" snapshot, by their rank there.
+	Entrants []DiffEntry `json:"entrants"`
+	// Exits are apps only in the "from" snapshot, by their rank there.
+	Exits []DiffEntry `json:"exits"`
+	// Moves are apps in both snapshots whose rank changed, by rank in "to".
+	Moves []RankChange `json:"moves"`
+	// Unchanged counts apps in both snapshots at the same rank.
+	Unchanged int `json:"unchanged"`
+}
+
+// DiffEntry is an app present in only one side of a SnapshotDiff.
+type DiffEntry struct {
+	AppID   string `json:"app_id"`
+	AppName string `json:"app_name"`
+	Rank    int    `json:"rank"`
+}
+
+// RankChange is an app present in both sides of a SnapshotDiff.
+type RankChange struct {
+	AppID    string `json:"app_id"`
+	AppName  string `json:"app_name"`
+	FromRank int    `json:"from_rank"`
+	ToRank   int    `json:"to_rank"`
+}
+
+// Empty reports whether the two snapshots rank the same apps identically.
+func (d SnapshotDiff) Empty() bool {
+	return len(d.Entrants) == 0 && len(d.Exits) == 0 && len(d.Moves) == 0
+}
+
+// CompareSnapshotsContext diffs snapshot fromID against toID. It returns
+// sql.ErrNoRows when either snapshot does not exist.
+func (s *Store) CompareSnapshotsContext(ctx context.Context, fromID, toID int64) (SnapshotDiff, error) {
+	diff := SnapshotDiff{FromID: fromID, ToID: toID}
+	if _, err := s.GetSnapshotByIDContext(ctx, fromID); err != nil {
+		return diff, err
+	}
+	if _, err := s.GetSnapshotByIDContext(ctx, toID); err != nil {
+		return diff, err
+	}
+	fromItems, err := s.GetSnapshotItemsContext(ctx, fromID)
+	if err != nil {
+		return diff, err
+	}
+	toItems, err := s.GetSnapshotItemsContext(ctx, toID)
+	if err != nil {
+		return diff, err
+	}
+
+	// Items come back ordered by rank, so the lists below are too.
+	fromRanks := make(map[string]int, len(fromItems))
+	for _, item := range fromItems {
+		fromRanks[item.AppID] = item.Rank
+	}
+	inTo := make(map[string]bool, len(toItems))
+	for _, item := range toItems {
+		inTo[item.AppID] = true
+		fromRank, ok := fromRanks[item.AppID]
+		switch {
+		case !ok:
+			diff.Entrants = append(diff.Entrants, DiffEntry{AppID: item.AppID, AppName: item.AppName, Rank: item.Rank})
+		case fromRank != item.Rank:
+			diff.Moves = append(diff.Moves, RankChange{AppID: item.AppID, AppName: item.AppName, FromRank: fromRank, ToRank: item.Rank})
+		default:
+			diff.Unchanged++
+		}
+	}
+	for _, item := range fromItems {
+		if !inTo[item.AppID] {
+			diff.Exits = append(diff.Exits, DiffEntry{AppID: item.AppID, AppName: item.AppName, Rank: item.Rank})
+		}
+	}
+	return diff, nil
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// chartItems returns one item per app id, ranked in the order given.
+func chartItems(ids ...string) []ChartItem {
+	items := make([]ChartItem, len(ids))
+	for i, id := range ids {
+		items[i] = ChartItem{Rank: i + 1, AppID: id, AppName: "App " + id}
+	}
+	return items
+}
+
+func TestCompareSnapshots(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to []string
+		want     SnapshotDiff
+	}{
+		{
+			name: "identical",
+			from: []string{"a", "b", "c"},
+			to:   []string{"a", "b", "c"},
+			want: SnapshotDiff{Unchanged: 3},
+		},
+		{
+			name: "full turnover",
+			from: []string{"a", "b"},
+			to:   []string{"x", "y"},
+			want: SnapshotDiff{
+				Entrants: []DiffEntry{{AppID: "x", AppName: "App x", Rank: 1}, {AppID: "y", AppName: "App y", Rank: 2}},
+				Exits:    []DiffEntry{{AppID: "a", AppName: "App a", Rank: 1}, {AppID: "b", AppName: "App b", Rank: 2}},
+			},
+		},
+		{
+			name: "partial overlap",
+			from: []string{"a", "b", "c", "d"},
+			to:   []string{"c", "b", "e", "d"},
+			want: SnapshotDiff{
+				Entrants:  []DiffEntry{{AppID: "e", AppName: "App e", Rank: 3}},
+				Exits:     []DiffEntry{{AppID: "a", AppName: "App a", Rank: 1}},
+				Moves:     []RankChange{{AppID: "c", AppName: "App c", FromRank: 3, ToRank: 1}},
+				Unchanged: 2,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, _ := openTestStore(t)
+			at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			fromID := insertTestSnapshot(t, st, testSnapshot("kr", "top-free", at), chartItems(tt.from...))
+			toID := insertTestSnapshot(t, st, testSnapshot("kr", "top-free", at.Add(time.Hour)), chartItems(tt.to...))
+
+			got, err := st.CompareSnapshots(fromID, toID)
+			if err != nil {
+				t.Fatalf("CompareSnapshots: %v", err)
+			}
+			tt.want.FromID, tt.want.ToID = fromID, toID
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diff = %+v\nwant   %+v", got, tt.want)
+			}
+			if got.Empty() != (tt.name == "identical") {
+				t.Errorf("Empty() = %v", got.Empty())
+			}
+		})
+	}
+}
+
+func TestCompareSnapshotsMissing(t *testing.T) {
+	st, _ := openTestStore(t)
+	id := insertTestSnapshot(t, st, testSnapshot("kr", "top-free", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)), chartItems("a"))
+	if _, err := st.CompareSnapshots(id, id+1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("err = %v, want sql.ErrNoRows", err)
+	}
+}
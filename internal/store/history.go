@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// AppHistoryPoint is one app's entry in one snapshot. Rank is unknown for
+// snapshots the app was not in.
+type AppHistoryPoint struct {
+	Snapshot
+	AppName       string
+	Rank          NullInt
+	RatingCount   NullInt
+	AverageRating NullFloat
+}
+
+// GetAppHistoryContext returns a point for every snapshot of country and
+// chart, oldest first, with the app's rank and ratings where it charted and
+// an unknown rank where it did not.
+func (s *Store) GetAppHistoryContext(ctx context.Context, country, chart, appID string) ([]AppHistoryPoint, error) {
+	name, genre := SplitChartKey(chart)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+snapshotColumns+`, chart_items.app_name, chart_items.rank, chart_items.rating_count, chart_items.average_rating
+		 FROM snapshots
+		 LEFT JOIN chart_items ON chart_items.snapshot_id = snapshots.id AND chart_items.app_id = ?
+		 WHERE country = ? AND chart = ? AND genre = ?
+		 ORDER BY collected_at ASC, id ASC`,
+		appID, country, name, genre,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []AppHistoryPoint
+	for rows.Next() {
+		var point AppHistoryPoint
+		var appName sql.NullString
+		var rank, ratingCount sql.NullInt64
+		var averageRating sql.NullFloat64
+		point.Snapshot, err = scanSnapshot(extraScanner{rows, []any{&appName, &rank, &ratingCount, &averageRating}})
+		if err != nil {
+			return nil, err
+		}
+		point.AppName = appName.String
+		if rank.Valid {
+			point.Rank = NullableInt(int(rank.Int64))
+		}
+		if ratingCount.Valid {
+			point.RatingCount = NullableInt(int(ratingCount.Int64))
+		}
+		if averageRating.Valid {
+			point.AverageRating = NullableFloat(averageRating.Float64)
+		}
+		points = append(points, point)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ImportedSnapshot is a snapshot rebuilt from exported data together with
+// its chart items.
+type ImportedSnapshot struct {
+	Snapshot
+	Items []ChartItem
+}
+
+// ImportResult counts what ImportSnapshots did with each snapshot.
+type ImportResult struct {
+	Inserted int
+	Replaced int
+	Skipped  int
+}
+
+// ImportSnapshotsContext inserts the snapshots and their items in a single
+// transaction, so a failure leaves the store as it was. A snapshot already
+// stored for the same country, chart, genre and collected_at is skipped, or
+// replaced along with its items when overwrite is set.
+func (s *Store) ImportSnapshotsContext(ctx context.Context, snapshots []ImportedSnapshot, overwrite bool) (ImportResult, error) {
+	var result ImportResult
+	tx, err := s.writer.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	for _, imported := range snapshots {
+		snapshot := imported.Snapshot
+		collectedAt := snapshot.CollectedAt.UTC().Format(time.RFC3339)
+		var existing int64
+		err := tx.QueryRowContext(ctx,
+			`SELECT id FROM snapshots WHERE country = ? AND chart = ? AND genre = ? AND collected_at = ?`,
+			snapshot.Country, snapshot.Chart, snapshot.Genre, collectedAt,
+		).Scan(&existing)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return result, err
+		case !overwrite:
+			result.Skipped++
+			continue
+		default:
+			if _, err := tx.ExecContext(ctx, `DELETE FROM snapshots WHERE id = ?`, existing); err != nil {
+				return result, err
+			}
+			result.Replaced++
+		}
+
+		id, err := insertSnapshot(ctx, tx, snapshot)
+		if err != nil {
+			return result, err
+		}
+		if err := insertChartItems(ctx, tx, id, imported.Items); err != nil {
+			return result, fmt.Errorf("snapshot %s %s %s: %w", collectedAt, snapshot.Country, snapshot.ChartKey(), err)
+		}
+		if existing == 0 {
+			result.Inserted++
+		}
+	}
+	return result, tx.Commit()
+}
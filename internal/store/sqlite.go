@@ -1,7 +1,12 @@
 package store
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,17 +16,103 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// Store is safe for concurrent use. Reads go through a pool of read-only
+// connections and writes through a single connection: in WAL mode readers
+// see the last committed state while a write is in progress, so only
+// writers need to take turns, and funnelling them through one connection
+// does that without busy errors between them.
 type Store struct {
-	db *sql.DB
+	db     *sql.DB
+	writer *sql.DB
 }
 
+const (
+	// maxReadConns bounds the read pool; each connection holds its own page
+	// cache.
+	maxReadConns = 8
+	// connMaxLifetime recycles connections now and then so a long-running
+	// serve doesn't keep one cache forever.
+	connMaxLifetime = time.Hour
+)
+
+// ErrNoSnapshots is returned when a country and chart have no snapshots to
+// read. It matches sql.ErrNoRows too, so checks for that keep working.
+var ErrNoSnapshots error = noSnapshotsError{}
+
+type noSnapshotsError struct{}
+
+func (noSnapshotsError) Error() string { return "no snapshots" }
+
+func (noSnapshotsError) Is(target error) bool { return target == sql.ErrNoRows }
+
 type Snapshot struct {
-	ID          int64
-	CollectedAt time.Time
-	Country     string
-	Chart       string
-	Limit       int
-	SourceURL   string
+	ID            int64
+	CollectedAt   time.Time
+	Country       string
+	Chart         string
+	Limit         int
+	SourceURL     string
+	ThemeConfigID int64
+	// FeedUpdated is the feed's own last-updated time; zero when the feed
+	// did not report one.
+	FeedUpdated time.Time
+	// Genre is the genre id a genre-scoped chart was fetched for; empty for
+	// the overall chart.
+	Genre string
+	// Tag is a free-form label set with SetSnapshotTag, e.g. "pre-holiday
+	// baseline"; empty when untagged.
+	Tag string
+	// ExpectedItems is the number of items the fetch meant to store, after
+	// dropping repeated and ignored apps, so verification can tell an
+	// interrupted insert from a short feed. Unknown for snapshots stored
+	// before it was recorded.
+	ExpectedItems NullInt
+}
+
+// ChartKey returns the key the store uses to tell a genre-scoped chart from
+// the overall one: the chart name, followed by ":" and the genre id when
+// there is one. Methods taking a chart accept either form.
+func ChartKey(chart, genre string) string {
+	if genre == "" {
+		return chart
+	}
+	return chart + ":" + genre
+}
+
+// SplitChartKey is the inverse of ChartKey.
+func SplitChartKey(key string) (chart, genre string) {
+	chart, genre, _ = strings.Cut(key, ":")
+	return chart, genre
+}
+
+// ChartKey returns the snapshot's chart key (see ChartKey).
+func (s Snapshot) ChartKey() string {
+	return ChartKey(s.Chart, s.Genre)
+}
+
+// DataTime is the time the snapshot's data reflects: the feed's own update
+// time when known, so repeated fetches of a stale feed land on the same
+// day, and the collection time otherwise.
+func (s Snapshot) DataTime() time.Time {
+	if !s.FeedUpdated.IsZero() {
+		return s.FeedUpdated
+	}
+	return s.CollectedAt
+}
+
+// SnapshotSummary is a snapshot together with the number of stored items.
+type SnapshotSummary struct {
+	Snapshot
+	ItemCount int
+}
+
+// ThemeConfigRecord is a theme config as it was stored when a snapshot was
+// collected, keyed by the sha256 of its content.
+type ThemeConfigRecord struct {
+	ID        int64
+	Hash      string
+	Content   []byte
+	CreatedAt time.Time
 }
 
 type ChartItem struct {
@@ -38,6 +129,10 @@ type ChartItem struct {
 	ItunesGenres  []string
 	RatingCount   NullInt
 	AverageRating NullFloat
+	ArtworkURL    string
+	// Theme is the theme assigned at collection time; empty for rows stored
+	// before themes were persisted.
+	Theme string
 }
 
 type NullInt struct {
@@ -58,24 +153,62 @@ func NullableFloat(value float64) NullFloat {
 	return NullFloat{Value: value, Valid: true}
 }
 
+// Ptr returns the value, or nil when it is unknown, for JSON output that
+// must tell a missing value from zero.
+func (n NullInt) Ptr() *int {
+	if !n.Valid {
+		return nil
+	}
+	value := n.Value
+	return &value
+}
+
+// Ptr returns the value, or nil when it is unknown.
+func (n NullFloat) Ptr() *float64 {
+	if !n.Valid {
+		return nil
+	}
+	value := n.Value
+	return &value
+}
+
 func Open(path string) (*Store, error) {
 	if err := ensureDir(path); err != nil {
 		return nil, err
 	}
-	db, err := sql.Open("sqlite", path)
+	// Pragmas go in the DSN so they apply to every connection in the pool:
+	// foreign_keys makes ON DELETE CASCADE fire, WAL lets readers proceed
+	// during a write, and busy_timeout waits out short lock contention,
+	// e.g. with another process writing to the same file.
+	dsn := path + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+	writer, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, err
 	}
-	st := &Store{db: db}
+	writer.SetMaxOpenConns(1)
+	writer.SetMaxIdleConns(1)
+	writer.SetConnMaxLifetime(connMaxLifetime)
+	// query_only makes a write sent to the read pool by mistake fail rather
+	// than race the writer.
+	db, err := sql.Open("sqlite", dsn+"&_pragma=query_only(1)")
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+	db.SetMaxOpenConns(maxReadConns)
+	db.SetMaxIdleConns(maxReadConns)
+	db.SetConnMaxLifetime(connMaxLifetime)
+
+	st := &Store{db: db, writer: writer}
 	if err := st.Init(); err != nil {
-		db.Close()
+		st.Close()
 		return nil, err
 	}
 	return st, nil
 }
 
 func (s *Store) Close() error {
-	return s.db.Close()
+	return errors.Join(s.db.Close(), s.writer.Close())
 }
 
 func (s *Store) Init() error {
@@ -86,7 +219,12 @@ CREATE TABLE IF NOT EXISTS snapshots (
   country TEXT NOT NULL,
   chart TEXT NOT NULL,
   limit_n INTEGER NOT NULL,
-  source_url TEXT NOT NULL
+  source_url TEXT NOT NULL,
+  theme_config_id INTEGER REFERENCES theme_configs(id),
+  feed_updated TEXT,
+  genre TEXT NOT NULL DEFAULT '',
+  tag TEXT NOT NULL DEFAULT '',
+  expected_items INTEGER
 );
 CREATE TABLE IF NOT EXISTS chart_items (
   snapshot_id INTEGER NOT NULL,
@@ -102,24 +240,219 @@ CREATE TABLE IF NOT EXISTS chart_items (
   itunes_genres TEXT,
   rating_count INTEGER,
   average_rating REAL,
+  artwork_url TEXT,
+  theme TEXT,
   PRIMARY KEY (snapshot_id, rank),
   UNIQUE (snapshot_id, app_id),
   FOREIGN KEY(snapshot_id) REFERENCES snapshots(id) ON DELETE CASCADE
 );
 CREATE INDEX IF NOT EXISTS idx_chart_items_app ON chart_items(app_id);
+CREATE TABLE IF NOT EXISTS theme_configs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  hash TEXT NOT NULL UNIQUE,
+  content TEXT NOT NULL,
+  created_at TEXT NOT NULL
+);
 `
-	_, err := s.db.Exec(schema)
+	if _, err := s.writer.Exec(schema); err != nil {
+		return err
+	}
+	return s.migrate()
+}
+
+// migrate adds columns introduced after the original schema so older
+// databases keep working.
+func (s *Store) migrate() error {
+	if err := s.addColumnIfMissing("snapshots", "theme_config_id", "INTEGER REFERENCES theme_configs(id)"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("chart_items", "artwork_url", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("snapshots", "feed_updated", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("chart_items", "theme", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("snapshots", "genre", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("snapshots", "tag", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("snapshots", "expected_items", "INTEGER"); err != nil {
+		return err
+	}
+	// Latest/previous/nearest lookups filter on the chart and order by
+	// collection time. The index is created here rather than in the schema
+	// because older databases only gain the genre column above.
+	if _, err := s.writer.Exec(`CREATE INDEX IF NOT EXISTS idx_snapshots_lookup ON snapshots(country, chart, genre, collected_at)`); err != nil {
+		return err
+	}
+	if err := s.migrateCollectedAtUTC(); err != nil {
+		return err
+	}
+	return s.migrateListEncoding()
+}
+
+// migrateCollectedAtUTC rewrites collection times stored with an offset,
+// as imports did before normalising them, in UTC. Lookups compare
+// collected_at as text, which only orders correctly in one zone.
+func (s *Store) migrateCollectedAtUTC() error {
+	rows, err := s.writer.Query(`SELECT id, collected_at FROM snapshots WHERE collected_at NOT LIKE '%Z'`)
+	if err != nil {
+		return err
+	}
+	converted := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var collected string
+		if err := rows.Scan(&id, &collected); err != nil {
+			rows.Close()
+			return err
+		}
+		parsed, err := time.Parse(time.RFC3339, collected)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("snapshot %d: parse collected_at: %w", id, err)
+		}
+		converted[id] = parsed.UTC().Format(time.RFC3339)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(converted) == 0 {
+		return nil
+	}
+
+	tx, err := s.writer.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for id, collected := range converted {
+		if _, err := tx.Exec(`UPDATE snapshots SET collected_at = ? WHERE id = ?`, collected, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateListEncoding rewrites list columns stored with the legacy
+// pipe-delimited encoding as JSON arrays.
+func (s *Store) migrateListEncoding() error {
+	rows, err := s.writer.Query(
+		`SELECT rowid, genres, genre_ids, itunes_genres
+		 FROM chart_items
+		 WHERE (genres <> '' AND genres NOT LIKE '[%')
+		    OR (genre_ids <> '' AND genre_ids NOT LIKE '[%')
+		    OR (itunes_genres <> '' AND itunes_genres NOT LIKE '[%')`,
+	)
+	if err != nil {
+		return err
+	}
+	type legacyRow struct {
+		rowID                          int64
+		genres, genreIDs, itunesGenres sql.NullString
+	}
+	var legacy []legacyRow
+	for rows.Next() {
+		var row legacyRow
+		if err := rows.Scan(&row.rowID, &row.genres, &row.genreIDs, &row.itunesGenres); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy = append(legacy, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	tx, err := s.writer.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`UPDATE chart_items SET genres = ?, genre_ids = ?, itunes_genres = ? WHERE rowid = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, row := range legacy {
+		if _, err := stmt.Exec(
+			joinList(splitList(row.genres.String)),
+			joinList(splitList(row.genreIDs.String)),
+			joinList(splitList(row.itunesGenres.String)),
+			row.rowID,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) addColumnIfMissing(table, column, definition string) error {
+	ok, err := s.hasColumn(table, column)
+	if err != nil || ok {
+		return err
+	}
+	_, err = s.writer.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	return err
 }
 
-func (s *Store) InsertSnapshot(snapshot Snapshot) (int64, error) {
-	res, err := s.db.Exec(
-		`INSERT INTO snapshots (collected_at, country, chart, limit_n, source_url) VALUES (?, ?, ?, ?, ?)`,
-		snapshot.CollectedAt.Format(time.RFC3339),
+func (s *Store) hasColumn(table, column string) (bool, error) {
+	rows, err := s.writer.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+func (s *Store) InsertSnapshotContext(ctx context.Context, snapshot Snapshot) (int64, error) {
+	return insertSnapshot(ctx, s.writer, snapshot)
+}
+
+// execer is the part of *sql.DB and *sql.Tx the insert helpers need.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertSnapshot(ctx context.Context, db execer, snapshot Snapshot) (int64, error) {
+	res, err := db.ExecContext(ctx,
+		`INSERT INTO snapshots (collected_at, country, chart, limit_n, source_url, theme_config_id, feed_updated, genre, tag, expected_items) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		snapshot.CollectedAt.UTC().Format(time.RFC3339),
 		snapshot.Country,
 		snapshot.Chart,
 		snapshot.Limit,
 		snapshot.SourceURL,
+		nullableID(snapshot.ThemeConfigID),
+		nullableTime(snapshot.FeedUpdated),
+		snapshot.Genre,
+		snapshot.Tag,
+		nullableInt(snapshot.ExpectedItems),
 	)
 	if err != nil {
 		return 0, err
@@ -127,7 +460,137 @@ func (s *Store) InsertSnapshot(snapshot Snapshot) (int64, error) {
 	return res.LastInsertId()
 }
 
-func (s *Store) InsertChartItem(item ChartItem) error {
+// SaveThemeConfigContext stores the given theme config content, returning the
+// id of an existing row when identical content was saved before. The insert
+// ignores a duplicate hash, so two processes saving the same config at once
+// both get the one row.
+func (s *Store) SaveThemeConfigContext(ctx context.Context, content []byte) (int64, error) {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	if _, err := s.writer.ExecContext(ctx,
+		`INSERT INTO theme_configs (hash, content, created_at) VALUES (?, ?, ?) ON CONFLICT(hash) DO NOTHING`,
+		hash,
+		string(content),
+		time.Now().UTC().Format(time.RFC3339),
+	); err != nil {
+		return 0, err
+	}
+	var id int64
+	if err := s.writer.QueryRowContext(ctx, `SELECT id FROM theme_configs WHERE hash = ?`, hash).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Store) GetThemeConfigContext(ctx context.Context, id int64) (ThemeConfigRecord, error) {
+	var record ThemeConfigRecord
+	var content, created string
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT id, hash, content, created_at FROM theme_configs WHERE id = ?`,
+		id,
+	).Scan(&record.ID, &record.Hash, &content, &created); err != nil {
+		return ThemeConfigRecord{}, err
+	}
+	parsed, err := time.Parse(time.RFC3339, created)
+	if err != nil {
+		return ThemeConfigRecord{}, fmt.Errorf("parse created_at: %w", err)
+	}
+	record.Content = []byte(content)
+	record.CreatedAt = parsed
+	return record, nil
+}
+
+func (s *Store) InsertChartItemContext(ctx context.Context, item ChartItem) error {
+	return s.InsertChartItemsContext(ctx, item.SnapshotID, []ChartItem{item})
+}
+
+// InsertChartItemsContext inserts all items for a snapshot in a single
+// transaction, so a failure leaves none of them behind.
+func (s *Store) InsertChartItemsContext(ctx context.Context, snapshotID int64, items []ChartItem) error {
+	tx, err := s.writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertChartItems(ctx, tx, snapshotID, items); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// InsertSnapshotWithItemsContext inserts a snapshot and its chart items in a
+// single transaction and returns the snapshot's id. A failure leaves neither
+// behind, so no half-written chart is ever visible to readers.
+func (s *Store) InsertSnapshotWithItemsContext(ctx context.Context, snapshot Snapshot, items []ChartItem) (int64, error) {
+	tx, err := s.writer.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := insertSnapshot(ctx, tx, snapshot)
+	if err != nil {
+		return 0, err
+	}
+	if err := insertChartItems(ctx, tx, id, items); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func insertChartItems(ctx context.Context, tx *sql.Tx, snapshotID int64, items []ChartItem) error {
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO chart_items (snapshot_id, rank, app_id, app_name, artist_name, app_url, release_date, genres, genre_ids, primary_genre, itunes_genres, rating_count, average_rating, artwork_url, theme)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, item := range items {
+		var ratingCount sql.NullInt64
+		var averageRating sql.NullFloat64
+		if item.RatingCount.Valid {
+			ratingCount = sql.NullInt64{Int64: int64(item.RatingCount.Value), Valid: true}
+		}
+		if item.AverageRating.Valid {
+			averageRating = sql.NullFloat64{Float64: item.AverageRating.Value, Valid: true}
+		}
+		if _, err := stmt.ExecContext(ctx,
+			snapshotID,
+			item.Rank,
+			item.AppID,
+			item.AppName,
+			item.ArtistName,
+			item.AppURL,
+			item.ReleaseDate,
+			joinList(item.Genres),
+			joinList(item.GenreIDs),
+			item.PrimaryGenre,
+			joinList(item.ItunesGenres),
+			ratingCount,
+			averageRating,
+			item.ArtworkURL,
+			nullableString(item.Theme),
+		); err != nil {
+			return fmt.Errorf("insert rank %d (%s): %w", item.Rank, item.AppID, err)
+		}
+	}
+	return nil
+}
+
+// DeleteSnapshotContext removes a snapshot and, via cascade, its chart items.
+func (s *Store) DeleteSnapshotContext(ctx context.Context, id int64) error {
+	_, err := s.writer.ExecContext(ctx, `DELETE FROM snapshots WHERE id = ?`, id)
+	return err
+}
+
+// UpdateChartItemEnrichmentContext rewrites the iTunes-derived columns of an
+// existing chart item, identified by snapshot and app id. The stored theme
+// is only replaced when item.Theme is set.
+func (s *Store) UpdateChartItemEnrichmentContext(ctx context.Context, item ChartItem) error {
 	var ratingCount sql.NullInt64
 	var averageRating sql.NullFloat64
 	if item.RatingCount.Valid {
@@ -136,116 +599,273 @@ func (s *Store) InsertChartItem(item ChartItem) error {
 	if item.AverageRating.Valid {
 		averageRating = sql.NullFloat64{Float64: item.AverageRating.Value, Valid: true}
 	}
-	_, err := s.db.Exec(
-		`INSERT INTO chart_items (snapshot_id, rank, app_id, app_name, artist_name, app_url, release_date, genres, genre_ids, primary_genre, itunes_genres, rating_count, average_rating)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		item.SnapshotID,
-		item.Rank,
-		item.AppID,
-		item.AppName,
-		item.ArtistName,
-		item.AppURL,
-		item.ReleaseDate,
-		joinList(item.Genres),
-		joinList(item.GenreIDs),
+	_, err := s.writer.ExecContext(ctx,
+		`UPDATE chart_items
+		 SET primary_genre = ?, itunes_genres = ?, rating_count = ?, average_rating = ?, theme = COALESCE(?, theme)
+		 WHERE snapshot_id = ? AND app_id = ?`,
 		item.PrimaryGenre,
 		joinList(item.ItunesGenres),
 		ratingCount,
 		averageRating,
+		nullableString(item.Theme),
+		item.SnapshotID,
+		item.AppID,
 	)
 	return err
 }
 
-func (s *Store) GetLatestSnapshot(country, chart string) (Snapshot, error) {
-	row := s.db.QueryRow(
-		`SELECT id, collected_at, country, chart, limit_n, source_url
+// ReplaceSnapshotThemesContext rewrites the stored theme of the given apps in
+// one snapshot and records themeConfigID as the config it was classified
+// with. themes maps app id to theme.
+func (s *Store) ReplaceSnapshotThemesContext(ctx context.Context, snapshotID, themeConfigID int64, themes map[string]string) error {
+	tx, err := s.writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `UPDATE chart_items SET theme = ? WHERE snapshot_id = ? AND app_id = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for appID, theme := range themes {
+		if _, err := stmt.ExecContext(ctx, nullableString(theme), snapshotID, appID); err != nil {
+			return fmt.Errorf("update theme of %s in snapshot %d: %w", appID, snapshotID, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE snapshots SET theme_config_id = ? WHERE id = ?`,
+		nullableID(themeConfigID), snapshotID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetSnapshotByIDContext returns the snapshot with the given id, or
+// sql.ErrNoRows.
+func (s *Store) GetSnapshotByIDContext(ctx context.Context, id int64) (Snapshot, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+snapshotColumns+` FROM snapshots WHERE id = ?`, id)
+	return scanSnapshot(row)
+}
+
+// GetLatestSnapshotContext returns the most recent snapshot, or
+// ErrNoSnapshots.
+func (s *Store) GetLatestSnapshotContext(ctx context.Context, country, chart string) (Snapshot, error) {
+	name, genre := SplitChartKey(chart)
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+snapshotColumns+`
 		 FROM snapshots
-		 WHERE country = ? AND chart = ?
+		 WHERE country = ? AND chart = ? AND genre = ?
 		 ORDER BY collected_at DESC
 		 LIMIT 1`,
-		country, chart,
+		country, name, genre,
 	)
-	return scanSnapshot(row)
+	return noSnapshots(scanSnapshot(row))
 }
 
-func (s *Store) GetPreviousSnapshot(country, chart string, before time.Time) (Snapshot, error) {
-	row := s.db.QueryRow(
-		`SELECT id, collected_at, country, chart, limit_n, source_url
+// GetSnapshotAsOfContext returns the most recent snapshot collected at or
+// before at, or ErrNoSnapshots when there is none.
+func (s *Store) GetSnapshotAsOfContext(ctx context.Context, country, chart string, at time.Time) (Snapshot, error) {
+	name, genre := SplitChartKey(chart)
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+snapshotColumns+`
 		 FROM snapshots
-		 WHERE country = ? AND chart = ? AND collected_at < ?
+		 WHERE country = ? AND chart = ? AND genre = ? AND collected_at <= ?
 		 ORDER BY collected_at DESC
 		 LIMIT 1`,
-		country, chart, before.Format(time.RFC3339),
+		country, name, genre, at.UTC().Format(time.RFC3339),
+	)
+	return noSnapshots(scanSnapshot(row))
+}
+
+// previousSnapshotQuery selects the latest snapshot of a chart collected
+// before a time; idx_snapshots_lookup serves both the filter and the order.
+const previousSnapshotQuery = `SELECT ` + snapshotColumns + `
+	FROM snapshots
+	WHERE country = ? AND chart = ? AND genre = ? AND collected_at < ?
+	ORDER BY collected_at DESC
+	LIMIT 1`
+
+// GetPreviousSnapshotContext returns the latest snapshot collected before the
+// given time, or sql.ErrNoRows.
+func (s *Store) GetPreviousSnapshotContext(ctx context.Context, country, chart string, before time.Time) (Snapshot, error) {
+	name, genre := SplitChartKey(chart)
+	// collected_at is compared as text, so format before in UTC as the
+	// other lookups do.
+	row := s.db.QueryRowContext(ctx, previousSnapshotQuery, country, name, genre, before.UTC().Format(time.RFC3339))
+	return scanSnapshot(row)
+}
+
+// GetSnapshotNearestTimeContext returns the snapshot whose collected_at is
+// closest to target, in either direction.
+func (s *Store) GetSnapshotNearestTimeContext(ctx context.Context, country, chart string, target time.Time) (Snapshot, error) {
+	name, genre := SplitChartKey(chart)
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+snapshotColumns+`
+		 FROM snapshots
+		 WHERE country = ? AND chart = ? AND genre = ?
+		 ORDER BY ABS(julianday(collected_at) - julianday(?)) ASC, collected_at DESC
+		 LIMIT 1`,
+		country, name, genre, target.UTC().Format(time.RFC3339),
 	)
 	return scanSnapshot(row)
 }
 
-func (s *Store) GetSnapshotItems(snapshotID int64) ([]ChartItem, error) {
-	rows, err := s.db.Query(
-		`SELECT snapshot_id, rank, app_id, app_name, artist_name, app_url, release_date, genres, genre_ids, primary_genre, itunes_genres, rating_count, average_rating
+// SnapshotExistsWithinContext reports whether a snapshot for country/chart
+// was collected within window of t, returning the id of the closest one.
+// The time range is a search on idx_snapshots_lookup, so only snapshots of
+// the chart inside the window are read.
+func (s *Store) SnapshotExistsWithinContext(ctx context.Context, country, chart string, t time.Time, window time.Duration) (bool, int64, error) {
+	name, genre := SplitChartKey(chart)
+	var id int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id
+		 FROM snapshots
+		 WHERE country = ? AND chart = ? AND genre = ? AND collected_at >= ? AND collected_at <= ?
+		 ORDER BY ABS(julianday(collected_at) - julianday(?)) ASC
+		 LIMIT 1`,
+		country, name, genre,
+		t.Add(-window).UTC().Format(time.RFC3339),
+		t.Add(window).UTC().Format(time.RFC3339),
+		t.UTC().Format(time.RFC3339),
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	return true, id, nil
+}
+
+func (s *Store) GetSnapshotItemsContext(ctx context.Context, snapshotID int64) ([]ChartItem, error) {
+	items, _, err := s.GetSnapshotItemsPagedContext(ctx, snapshotID, 0, 0)
+	return items, err
+}
+
+// GetSnapshotItemsPagedContext returns up to limit items of a snapshot by
+// rank, skipping the first offset, along with the snapshot's total item
+// count. A limit of 0 or less returns every item from offset on.
+func (s *Store) GetSnapshotItemsPagedContext(ctx context.Context, snapshotID int64, limit, offset int) ([]ChartItem, int, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	var total int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM chart_items WHERE snapshot_id = ?`, snapshotID,
+	).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+chartItemColumns+`
 		 FROM chart_items
 		 WHERE snapshot_id = ?
-		 ORDER BY rank ASC`,
-		snapshotID,
+		 ORDER BY rank ASC
+		 LIMIT ? OFFSET ?`,
+		snapshotID, limit, offset,
 	)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	var items []ChartItem
 	for rows.Next() {
-		var item ChartItem
-		var genres, genreIDs, itunesGenres sql.NullString
-		var ratingCount sql.NullInt64
-		var averageRating sql.NullFloat64
-		if err := rows.Scan(
-			&item.SnapshotID,
-			&item.Rank,
-			&item.AppID,
-			&item.AppName,
-			&item.ArtistName,
-			&item.AppURL,
-			&item.ReleaseDate,
-			&genres,
-			&genreIDs,
-			&item.PrimaryGenre,
-			&itunesGenres,
-			&ratingCount,
-			&averageRating,
-		); err != nil {
-			return nil, err
-		}
-		if genres.Valid {
-			item.Genres = splitList(genres.String)
+		item, err := scanChartItem(rows)
+		if err != nil {
+			return nil, 0, err
 		}
-		if genreIDs.Valid {
-			item.GenreIDs = splitList(genreIDs.String)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// EachChartItemContext calls fn for every chart item with its snapshot,
+// oldest snapshot first and by rank within a snapshot, reading rows as it
+// goes rather than loading them all. Empty country or chart match all values;
+// a zero since or until leaves that end of the range open.
+func (s *Store) EachChartItemContext(ctx context.Context, country, chart string, since, until time.Time, fn func(Snapshot, ChartItem) error) error {
+	name, genre := SplitChartKey(chart)
+	where := `(? = '' OR country = ?) AND (? = '' OR (chart = ? AND genre = ?))
+		 AND (? = '' OR collected_at >= ?) AND (? = '' OR collected_at <= ?)`
+	sinceArg, untilArg := formatBound(since), formatBound(until)
+	args := []any{country, country, chart, name, genre, sinceArg, sinceArg, untilArg, untilArg}
+
+	snapshots := map[int64]Snapshot{}
+	rows, err := s.db.QueryContext(ctx, `SELECT `+snapshotColumns+` FROM snapshots WHERE `+where, args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		snapshot, err := scanSnapshot(rows)
+		if err != nil {
+			rows.Close()
+			return err
 		}
-		if itunesGenres.Valid {
-			item.ItunesGenres = splitList(itunesGenres.String)
+		snapshots[snapshot.ID] = snapshot
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = s.db.QueryContext(ctx,
+		`SELECT `+chartItemColumns+`
+		 FROM chart_items JOIN snapshots ON snapshots.id = chart_items.snapshot_id
+		 WHERE `+where+`
+		 ORDER BY collected_at ASC, snapshot_id ASC, rank ASC`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item, err := scanChartItem(rows)
+		if err != nil {
+			return err
 		}
-		if ratingCount.Valid {
-			item.RatingCount = NullInt{Value: int(ratingCount.Int64), Valid: true}
+		snapshot, ok := snapshots[item.SnapshotID]
+		if !ok {
+			// Collected after the snapshot list was read.
+			continue
 		}
-		if averageRating.Valid {
-			item.AverageRating = NullFloat{Value: averageRating.Float64, Valid: true}
+		if err := fn(snapshot, item); err != nil {
+			return err
 		}
-		items = append(items, item)
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+	return rows.Err()
+}
+
+func formatBound(t time.Time) string {
+	if t.IsZero() {
+		return ""
 	}
-	return items, nil
+	return t.UTC().Format(time.RFC3339)
 }
 
-func (s *Store) ListSnapshots(country, chart string) ([]Snapshot, error) {
-	rows, err := s.db.Query(
-		`SELECT id, collected_at, country, chart, limit_n, source_url
+func (s *Store) ListSnapshotsContext(ctx context.Context, country, chart string) ([]Snapshot, error) {
+	return s.ListSnapshotsBetweenContext(ctx, country, chart, time.Time{}, time.Time{})
+}
+
+// ListSnapshotsBetweenContext returns the snapshots for country and chart
+// collected within [since, until], oldest first. A zero since or until leaves
+// that end of the range open.
+func (s *Store) ListSnapshotsBetweenContext(ctx context.Context, country, chart string, since, until time.Time) ([]Snapshot, error) {
+	name, genre := SplitChartKey(chart)
+	sinceArg, untilArg := formatBound(since), formatBound(until)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+snapshotColumns+`
 		 FROM snapshots
-		 WHERE country = ? AND chart = ?
+		 WHERE country = ? AND chart = ? AND genre = ?
+		   AND (? = '' OR collected_at >= ?) AND (? = '' OR collected_at <= ?)
 		 ORDER BY collected_at ASC`,
-		country, chart,
+		country, name, genre, sinceArg, sinceArg, untilArg, untilArg,
 	)
 	if err != nil {
 		return nil, err
@@ -254,23 +874,43 @@ func (s *Store) ListSnapshots(country, chart string) ([]Snapshot, error) {
 
 	var snapshots []Snapshot
 	for rows.Next() {
-		var snapshot Snapshot
-		var collected string
-		if err := rows.Scan(
-			&snapshot.ID,
-			&collected,
-			&snapshot.Country,
-			&snapshot.Chart,
-			&snapshot.Limit,
-			&snapshot.SourceURL,
-		); err != nil {
+		snapshot, err := scanSnapshot(rows)
+		if err != nil {
 			return nil, err
 		}
-		parsed, err := time.Parse(time.RFC3339, collected)
+		snapshots = append(snapshots, snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// ListRecentSnapshotsContext returns the newest n snapshots for country and
+// chart, oldest first.
+func (s *Store) ListRecentSnapshotsContext(ctx context.Context, country, chart string, n int) ([]Snapshot, error) {
+	name, genre := SplitChartKey(chart)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+snapshotColumns+` FROM (
+		   SELECT `+snapshotColumns+`
+		   FROM snapshots
+		   WHERE country = ? AND chart = ? AND genre = ?
+		   ORDER BY collected_at DESC, id DESC
+		   LIMIT ?
+		 ) ORDER BY collected_at ASC, id ASC`,
+		country, name, genre, n,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []Snapshot
+	for rows.Next() {
+		snapshot, err := scanSnapshot(rows)
 		if err != nil {
-			return nil, fmt.Errorf("parse collected_at: %w", err)
+			return nil, err
 		}
-		snapshot.CollectedAt = parsed
 		snapshots = append(snapshots, snapshot)
 	}
 	if err := rows.Err(); err != nil {
@@ -279,9 +919,224 @@ func (s *Store) ListSnapshots(country, chart string) ([]Snapshot, error) {
 	return snapshots, nil
 }
 
-func scanSnapshot(row *sql.Row) (Snapshot, error) {
+// ListSnapshotSummariesContext returns snapshots newest first with their item
+// counts. Empty country or chart match all values; limit <= 0 means no limit.
+func (s *Store) ListSnapshotSummariesContext(ctx context.Context, country, chart string, limit int) ([]SnapshotSummary, error) {
+	summaries, _, err := s.ListSnapshotSummariesPagedContext(ctx, country, chart, limit, 0)
+	return summaries, err
+}
+
+// ListSnapshotSummariesPagedContext is ListSnapshotSummaries skipping the
+// newest offset snapshots, and also returns how many snapshots match in
+// total.
+func (s *Store) ListSnapshotSummariesPagedContext(ctx context.Context, country, chart string, limit, offset int) ([]SnapshotSummary, int, error) {
+	name, genre := SplitChartKey(chart)
+	return s.listSnapshotSummaries(ctx,
+		`(? = '' OR country = ?) AND (? = '' OR (chart = ? AND genre = ?))`,
+		[]any{country, country, chart, name, genre},
+		limit, offset,
+	)
+}
+
+// listSnapshotSummaries returns the summaries of the snapshots matching
+// where, newest first, and how many match in total.
+func (s *Store) listSnapshotSummaries(ctx context.Context, where string, args []any, limit, offset int) ([]SnapshotSummary, int, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	var total int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM snapshots WHERE `+where,
+		args...,
+	).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+snapshotColumns+`,
+		   (SELECT COUNT(*) FROM chart_items WHERE chart_items.snapshot_id = snapshots.id)
+		 FROM snapshots
+		 WHERE `+where+`
+		 ORDER BY collected_at DESC, id DESC
+		 LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var summaries []SnapshotSummary
+	for rows.Next() {
+		var summary SnapshotSummary
+		var count int
+		summary.Snapshot, err = scanSnapshot(countScanner{rows, &count})
+		if err != nil {
+			return nil, 0, err
+		}
+		summary.ItemCount = count
+		summaries = append(summaries, summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return summaries, total, nil
+}
+
+// CountSnapshotsContext returns how many snapshots exist for the country and
+// chart.
+func (s *Store) CountSnapshotsContext(ctx context.Context, country, chart string) (int, error) {
+	name, genre := SplitChartKey(chart)
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM snapshots WHERE country = ? AND chart = ? AND genre = ?`,
+		country, name, genre,
+	).Scan(&count)
+	return count, err
+}
+
+// SnapshotChecksumContext returns a digest of a snapshot's row and items. It
+// changes whenever either is rewritten in place, e.g. by deferred
+// enrichment, a theme backfill or a new tag, which its id alone does not
+// reveal. A missing snapshot yields sql.ErrNoRows.
+func (s *Store) SnapshotChecksumContext(ctx context.Context, id int64) (string, error) {
+	snapshot, err := s.GetSnapshotByIDContext(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%+v\x00", snapshot)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+chartItemColumns+` FROM chart_items WHERE snapshot_id = ? ORDER BY rank ASC`,
+		id,
+	)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return "", err
+		}
+		for _, value := range values {
+			// Tell NULL from an empty value.
+			if value == nil {
+				h.Write([]byte{1})
+				continue
+			}
+			fmt.Fprintf(h, "\x00%d:%s", len(value), value)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// countScanner appends a trailing count column to a snapshot row scan.
+type countScanner struct {
+	row   rowScanner
+	count *int
+}
+
+func (c countScanner) Scan(dest ...any) error {
+	return c.row.Scan(append(dest, c.count)...)
+}
+
+// DeleteSnapshotsOlderThanContext deletes snapshots collected before cutoff,
+// along with their chart items, and returns them. Empty country or chart
+// match all values. With dryRun the transaction is rolled back.
+func (s *Store) DeleteSnapshotsOlderThanContext(ctx context.Context, country, chart string, cutoff time.Time, dryRun bool) ([]Snapshot, error) {
+	name, genre := SplitChartKey(chart)
+	return s.deleteSnapshotsWhere(ctx,
+		`(? = '' OR country = ?) AND (? = '' OR (chart = ? AND genre = ?)) AND collected_at < ?`,
+		[]any{country, country, chart, name, genre, cutoff.UTC().Format(time.RFC3339)},
+		dryRun,
+	)
+}
+
+// DeleteSnapshotsKeepingLastContext deletes all but the newest keep snapshots
+// of each country/chart pair and returns the deleted snapshots.
+func (s *Store) DeleteSnapshotsKeepingLastContext(ctx context.Context, country, chart string, keep int, dryRun bool) ([]Snapshot, error) {
+	name, genre := SplitChartKey(chart)
+	return s.deleteSnapshotsWhere(ctx,
+		`id IN (
+		   SELECT id FROM (
+		     SELECT id, ROW_NUMBER() OVER (PARTITION BY country, chart, genre ORDER BY collected_at DESC, id DESC) AS pos
+		     FROM snapshots
+		     WHERE (? = '' OR country = ?) AND (? = '' OR (chart = ? AND genre = ?))
+		   ) WHERE pos > ?
+		 )`,
+		[]any{country, country, chart, name, genre, keep},
+		dryRun,
+	)
+}
+
+func (s *Store) deleteSnapshotsWhere(ctx context.Context, where string, args []any, dryRun bool) ([]Snapshot, error) {
+	tx, err := s.writer.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+snapshotColumns+` FROM snapshots WHERE `+where+` ORDER BY collected_at ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []Snapshot
+	for rows.Next() {
+		snapshot, err := scanSnapshot(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if dryRun || len(snapshots) == 0 {
+		return snapshots, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM snapshots WHERE `+where, args...); err != nil {
+		return nil, err
+	}
+	return snapshots, tx.Commit()
+}
+
+const snapshotColumns = `id, collected_at, country, chart, limit_n, source_url, theme_config_id, feed_updated, genre, tag, expected_items`
+
+const chartItemColumns = `snapshot_id, rank, app_id, app_name, artist_name, app_url, release_date, genres, genre_ids, primary_genre, itunes_genres, rating_count, average_rating, artwork_url, theme`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// noSnapshots turns scanSnapshot's sql.ErrNoRows into ErrNoSnapshots for
+// lookups that come up empty only when the chart has no snapshots at all.
+func noSnapshots(snapshot Snapshot, err error) (Snapshot, error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		return snapshot, ErrNoSnapshots
+	}
+	return snapshot, err
+}
+
+func scanSnapshot(row rowScanner) (Snapshot, error) {
 	var snapshot Snapshot
 	var collected string
+	var themeConfigID sql.NullInt64
+	var feedUpdated sql.NullString
+	var expectedItems sql.NullInt64
 	if err := row.Scan(
 		&snapshot.ID,
 		&collected,
@@ -289,6 +1144,11 @@ func scanSnapshot(row *sql.Row) (Snapshot, error) {
 		&snapshot.Chart,
 		&snapshot.Limit,
 		&snapshot.SourceURL,
+		&themeConfigID,
+		&feedUpdated,
+		&snapshot.Genre,
+		&snapshot.Tag,
+		&expectedItems,
 	); err != nil {
 		return Snapshot{}, err
 	}
@@ -297,9 +1157,83 @@ func scanSnapshot(row *sql.Row) (Snapshot, error) {
 		return Snapshot{}, fmt.Errorf("parse collected_at: %w", err)
 	}
 	snapshot.CollectedAt = parsed
+	snapshot.ThemeConfigID = themeConfigID.Int64
+	if expectedItems.Valid {
+		snapshot.ExpectedItems = NullableInt(int(expectedItems.Int64))
+	}
+	if feedUpdated.Valid && feedUpdated.String != "" {
+		updated, err := time.Parse(time.RFC3339, feedUpdated.String)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("parse feed_updated: %w", err)
+		}
+		snapshot.FeedUpdated = updated
+	}
 	return snapshot, nil
 }
 
+func scanChartItem(row rowScanner) (ChartItem, error) {
+	var item ChartItem
+	var genres, genreIDs, itunesGenres, artworkURL, theme sql.NullString
+	var ratingCount sql.NullInt64
+	var averageRating sql.NullFloat64
+	if err := row.Scan(
+		&item.SnapshotID,
+		&item.Rank,
+		&item.AppID,
+		&item.AppName,
+		&item.ArtistName,
+		&item.AppURL,
+		&item.ReleaseDate,
+		&genres,
+		&genreIDs,
+		&item.PrimaryGenre,
+		&itunesGenres,
+		&ratingCount,
+		&averageRating,
+		&artworkURL,
+		&theme,
+	); err != nil {
+		return ChartItem{}, err
+	}
+	item.ArtworkURL = artworkURL.String
+	item.Theme = theme.String
+	if genres.Valid {
+		item.Genres = splitList(genres.String)
+	}
+	if genreIDs.Valid {
+		item.GenreIDs = splitList(genreIDs.String)
+	}
+	if itunesGenres.Valid {
+		item.ItunesGenres = splitList(itunesGenres.String)
+	}
+	if ratingCount.Valid {
+		item.RatingCount = NullInt{Value: int(ratingCount.Int64), Valid: true}
+	}
+	if averageRating.Valid {
+		item.AverageRating = NullFloat{Value: averageRating.Float64, Valid: true}
+	}
+	return item, nil
+}
+
+func nullableID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+func nullableInt(n NullInt) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n.Value), Valid: n.Valid}
+}
+
+func nullableString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func nullableTime(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.UTC().Format(time.RFC3339), Valid: true}
+}
+
 func ensureDir(path string) error {
 	dir := filepath.Dir(path)
 	if dir == "." || dir == "" {
@@ -308,16 +1242,30 @@ func ensureDir(path string) error {
 	return os.MkdirAll(dir, 0o755)
 }
 
+// joinList encodes a list column as a JSON array so values containing any
+// delimiter character round-trip safely.
 func joinList(values []string) string {
 	if len(values) == 0 {
 		return ""
 	}
-	return strings.Join(values, "|")
+	data, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+	return string(data)
 }
 
+// splitList decodes a list column, accepting the legacy pipe-delimited
+// encoding for rows that predate the JSON migration.
 func splitList(value string) []string {
 	if value == "" {
 		return nil
 	}
+	if strings.HasPrefix(value, "[") {
+		var values []string
+		if err := json.Unmarshal([]byte(value), &values); err == nil {
+			return values
+		}
+	}
 	return strings.Split(value, "|")
 }
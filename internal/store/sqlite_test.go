@@ -0,0 +1,349 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	st, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st, path
+}
+
+func insertTestSnapshot(t *testing.T, st *Store, snapshot Snapshot, items []ChartItem) int64 {
+	t.Helper()
+	id, err := st.InsertSnapshot(snapshot)
+	if err != nil {
+		t.Fatalf("InsertSnapshot: %v", err)
+	}
+	if err := st.InsertChartItems(id, items); err != nil {
+		t.Fatalf("InsertChartItems: %v", err)
+	}
+	return id
+}
+
+func testSnapshot(country, chart string, at time.Time) Snapshot {
+	return Snapshot{CollectedAt: at, Country: country, Chart: chart, Limit: 100, SourceURL: "https://example.com/" + country + "/" + chart}
+}
+
+func TestListColumnsRoundTripPipes(t *testing.T) {
+	st, _ := openTestStore(t)
+	item := ChartItem{
+		Rank:         1,
+		AppID:        "1",
+		AppName:      "Recipes",
+		AppURL:       "https://example.com/1",
+		Genres:       []string{"Food | Drink", "Lifestyle"},
+		GenreIDs:     []string{"6023", "6012"},
+		ItunesGenres: []string{"Food | Drink"},
+	}
+	id := insertTestSnapshot(t, st, testSnapshot("kr", "top-free", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)), []ChartItem{item})
+
+	items, err := st.GetSnapshotItems(id)
+	if err != nil {
+		t.Fatalf("GetSnapshotItems: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	got := items[0]
+	if !reflect.DeepEqual(got.Genres, item.Genres) {
+		t.Errorf("Genres = %q, want %q", got.Genres, item.Genres)
+	}
+	if !reflect.DeepEqual(got.GenreIDs, item.GenreIDs) {
+		t.Errorf("GenreIDs = %q, want %q", got.GenreIDs, item.GenreIDs)
+	}
+	if !reflect.DeepEqual(got.ItunesGenres, item.ItunesGenres) {
+		t.Errorf("ItunesGenres = %q, want %q", got.ItunesGenres, item.ItunesGenres)
+	}
+}
+
+func TestOpenMigratesPipeJoinedLists(t *testing.T) {
+	st, path := openTestStore(t)
+	id := insertTestSnapshot(t, st, testSnapshot("kr", "top-free", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)), nil)
+	if _, err := st.writer.Exec(
+		`INSERT INTO chart_items (snapshot_id, rank, app_id, app_name, artist_name, app_url, release_date, genres, genre_ids, primary_genre, itunes_genres, artwork_url)
+		 VALUES (?, 1, '1', 'Puzzles', '', '', '', 'Games|Puzzle', '6014|7012', '', '', '')`,
+		id,
+	); err != nil {
+		t.Fatalf("insert legacy row: %v", err)
+	}
+	st.Close()
+
+	st, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer st.Close()
+
+	var genres, genreIDs string
+	if err := st.db.QueryRow(`SELECT genres, genre_ids FROM chart_items WHERE snapshot_id = ?`, id).Scan(&genres, &genreIDs); err != nil {
+		t.Fatalf("read migrated row: %v", err)
+	}
+	if genres != `["Games","Puzzle"]` || genreIDs != `["6014","7012"]` {
+		t.Errorf("stored lists = %s, %s; want JSON arrays", genres, genreIDs)
+	}
+	items, err := st.GetSnapshotItems(id)
+	if err != nil {
+		t.Fatalf("GetSnapshotItems: %v", err)
+	}
+	if want := []string{"Games", "Puzzle"}; !reflect.DeepEqual(items[0].Genres, want) {
+		t.Errorf("Genres = %q, want %q", items[0].Genres, want)
+	}
+	if len(items[0].ItunesGenres) != 0 {
+		t.Errorf("ItunesGenres = %q, want empty", items[0].ItunesGenres)
+	}
+}
+
+func TestInsertSnapshotWithItemsRollsBack(t *testing.T) {
+	st, _ := openTestStore(t)
+	// The repeated app id violates UNIQUE(snapshot_id, app_id) on the second
+	// item, after the snapshot row has been written.
+	items := []ChartItem{{Rank: 1, AppID: "1", AppName: "One"}, {Rank: 2, AppID: "1", AppName: "One again"}}
+	if _, err := st.InsertSnapshotWithItems(testSnapshot("kr", "top-free", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)), items); err == nil {
+		t.Fatal("InsertSnapshotWithItems accepted a repeated app")
+	}
+	var snapshots int
+	if err := st.db.QueryRow(`SELECT COUNT(*) FROM snapshots`).Scan(&snapshots); err != nil {
+		t.Fatalf("count snapshots: %v", err)
+	}
+	if snapshots != 0 {
+		t.Errorf("%d snapshots left after a failed insert, want 0", snapshots)
+	}
+
+	items[1].AppID = "2"
+	id, err := st.InsertSnapshotWithItems(testSnapshot("kr", "top-free", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)), items)
+	if err != nil {
+		t.Fatalf("InsertSnapshotWithItems: %v", err)
+	}
+	stored, err := st.GetSnapshotItems(id)
+	if err != nil {
+		t.Fatalf("GetSnapshotItems: %v", err)
+	}
+	if len(stored) != 2 {
+		t.Errorf("got %d items, want 2", len(stored))
+	}
+}
+
+func TestOpenEnablesPragmas(t *testing.T) {
+	st, _ := openTestStore(t)
+	var mode string
+	if err := st.db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil {
+		t.Fatalf("journal_mode: %v", err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q, want wal", mode)
+	}
+
+	items := []ChartItem{{Rank: 1, AppID: "1", AppName: "One"}, {Rank: 2, AppID: "2", AppName: "Two"}}
+	id := insertTestSnapshot(t, st, testSnapshot("kr", "top-free", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)), items)
+	if err := st.DeleteSnapshot(id); err != nil {
+		t.Fatalf("DeleteSnapshot: %v", err)
+	}
+	// Deleting the snapshot must cascade to its items on every connection,
+	// which needs foreign_keys on in the DSN rather than on one connection.
+	var count int
+	if err := st.db.QueryRow(`SELECT COUNT(*) FROM chart_items`).Scan(&count); err != nil {
+		t.Fatalf("count chart_items: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("%d chart_items left after deleting their snapshot, want 0", count)
+	}
+}
+
+func TestGetPreviousSnapshot(t *testing.T) {
+	st, _ := openTestStore(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ids := map[string][]int64{}
+	for day := 0; day < 10; day++ {
+		for _, country := range []string{"kr", "jp", "us"} {
+			for _, chart := range []string{"top-free", "top-paid", "top-grossing"} {
+				// Offset the charts so their snapshots interleave in time.
+				at := start.AddDate(0, 0, day).Add(time.Duration(len(ids)%7) * time.Minute)
+				snapshot := testSnapshot(country, chart, at)
+				key := country + "/" + chart
+				ids[key] = append(ids[key], insertTestSnapshot(t, st, snapshot, nil))
+			}
+		}
+		genre := testSnapshot("kr", "top-free", start.AddDate(0, 0, day).Add(30*time.Minute))
+		genre.Genre = "6014"
+		ids["kr/top-free:6014"] = append(ids["kr/top-free:6014"], insertTestSnapshot(t, st, genre, nil))
+	}
+
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		country, chart string
+		before         time.Time
+		wantDay        int // -1 when there is no earlier snapshot
+	}{
+		{"kr", "top-free", start.AddDate(0, 0, 5), 4},
+		{"jp", "top-paid", start.AddDate(0, 0, 5).Add(time.Hour), 5},
+		{"us", "top-grossing", start.AddDate(0, 0, 20), 9},
+		{"kr", "top-free:6014", start.AddDate(0, 0, 3).Add(time.Hour), 3},
+		{"kr", "top-free", start, -1},
+		// 09:00 in Seoul is midnight UTC, so day 2 has not been collected yet.
+		{"kr", "top-paid", time.Date(2024, 1, 3, 9, 0, 0, 0, seoul), 1},
+	}
+	for _, tt := range tests {
+		got, err := st.GetPreviousSnapshot(tt.country, tt.chart, tt.before)
+		if tt.wantDay < 0 {
+			if !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("%s/%s before %s: err = %v, want sql.ErrNoRows", tt.country, tt.chart, tt.before, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s/%s before %s: %v", tt.country, tt.chart, tt.before, err)
+			continue
+		}
+		if want := ids[tt.country+"/"+tt.chart][tt.wantDay]; got.ID != want {
+			t.Errorf("%s/%s before %s: got snapshot %d, want %d", tt.country, tt.chart, tt.before, got.ID, want)
+		}
+	}
+
+	rows, err := st.db.Query(`EXPLAIN QUERY PLAN `+previousSnapshotQuery, "kr", "top-free", "", start.Format(time.RFC3339))
+	if err != nil {
+		t.Fatalf("explain: %v", err)
+	}
+	defer rows.Close()
+	var plan []string
+	for rows.Next() {
+		var id, parent, notused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+			t.Fatalf("scan plan: %v", err)
+		}
+		plan = append(plan, detail)
+	}
+	joined := strings.Join(plan, "; ")
+	if !strings.Contains(joined, "idx_snapshots_lookup") {
+		t.Errorf("query plan %q does not use idx_snapshots_lookup", joined)
+	}
+	if strings.Contains(joined, "TEMP B-TREE") {
+		t.Errorf("query plan %q sorts instead of walking the index", joined)
+	}
+}
+
+func TestSnapshotExistsWithin(t *testing.T) {
+	st, _ := openTestStore(t)
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	early := insertTestSnapshot(t, st, testSnapshot("kr", "top-free", at), nil)
+	late := insertTestSnapshot(t, st, testSnapshot("kr", "top-free", at.Add(3*time.Hour)), nil)
+	insertTestSnapshot(t, st, testSnapshot("kr", "top-paid", at.Add(time.Hour)), nil)
+
+	tests := []struct {
+		chart  string
+		t      time.Time
+		window time.Duration
+		wantID int64 // 0 when no snapshot is in the window
+	}{
+		{"top-free", at.Add(time.Hour), 2 * time.Hour, early},
+		{"top-free", at.Add(2 * time.Hour), 2 * time.Hour, late},
+		{"top-free", at.Add(90 * time.Minute), 30 * time.Minute, 0},
+		{"top-free:6014", at, time.Hour, 0},
+		{"top-paid", at.Add(90 * time.Minute), time.Hour, 3},
+	}
+	for _, tt := range tests {
+		ok, id, err := st.SnapshotExistsWithin("kr", tt.chart, tt.t, tt.window)
+		if err != nil {
+			t.Fatalf("SnapshotExistsWithin: %v", err)
+		}
+		if ok != (tt.wantID != 0) || id != tt.wantID {
+			t.Errorf("%s within %s of %s = %v, %d; want snapshot %d", tt.chart, tt.window, tt.t, ok, id, tt.wantID)
+		}
+	}
+}
+
+func TestSaveThemeConfigReusesRow(t *testing.T) {
+	st, _ := openTestStore(t)
+	first, err := st.SaveThemeConfig([]byte(`{"themes":[]}`))
+	if err != nil {
+		t.Fatalf("SaveThemeConfig: %v", err)
+	}
+	again, err := st.SaveThemeConfig([]byte(`{"themes":[]}`))
+	if err != nil {
+		t.Fatalf("SaveThemeConfig again: %v", err)
+	}
+	other, err := st.SaveThemeConfig([]byte(`{"themes":[{"name":"x"}]}`))
+	if err != nil {
+		t.Fatalf("SaveThemeConfig other: %v", err)
+	}
+	if again != first || other == first {
+		t.Errorf("ids = %d, %d, %d; want the same content to reuse its row", first, again, other)
+	}
+}
+
+func TestSnapshotChecksumChangesOnRewrite(t *testing.T) {
+	st, _ := openTestStore(t)
+	id := insertTestSnapshot(t, st, testSnapshot("kr", "top-free", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)), []ChartItem{
+		{Rank: 1, AppID: "1", AppName: "One"},
+		{Rank: 2, AppID: "2", AppName: "Two"},
+	})
+	checksum := func() string {
+		t.Helper()
+		sum, err := st.SnapshotChecksum(id)
+		if err != nil {
+			t.Fatalf("SnapshotChecksum: %v", err)
+		}
+		return sum
+	}
+
+	first := checksum()
+	if again := checksum(); again != first {
+		t.Fatalf("checksum changed without a write: %s, then %s", first, again)
+	}
+	if err := st.UpdateChartItemEnrichment(ChartItem{SnapshotID: id, AppID: "2", RatingCount: NullableInt(10)}); err != nil {
+		t.Fatalf("UpdateChartItemEnrichment: %v", err)
+	}
+	enriched := checksum()
+	if enriched == first {
+		t.Error("checksum unchanged after enrichment")
+	}
+	if err := st.SetSnapshotTag(id, "baseline"); err != nil {
+		t.Fatalf("SetSnapshotTag: %v", err)
+	}
+	if checksum() == enriched {
+		t.Error("checksum unchanged after tagging")
+	}
+	if _, err := st.SnapshotChecksum(id + 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("checksum of a missing snapshot: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestOpenMigratesCollectedAtToUTC(t *testing.T) {
+	st, path := openTestStore(t)
+	at := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	id := insertTestSnapshot(t, st, testSnapshot("kr", "top-free", at), nil)
+	if _, err := st.writer.Exec(`UPDATE snapshots SET collected_at = '2024-01-15T09:00:00+09:00' WHERE id = ?`, id); err != nil {
+		t.Fatalf("store offset time: %v", err)
+	}
+	st.Close()
+
+	st, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer st.Close()
+
+	var collected string
+	if err := st.db.QueryRow(`SELECT collected_at FROM snapshots WHERE id = ?`, id).Scan(&collected); err != nil {
+		t.Fatalf("read migrated row: %v", err)
+	}
+	if want := at.Format(time.RFC3339); collected != want {
+		t.Errorf("collected_at = %s, want %s", collected, want)
+	}
+}
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SetSnapshotTagContext labels a snapshot, replacing any tag it had; an empty
+// tag clears it. It returns sql.ErrNoRows when no snapshot has the id.
+func (s *Store) SetSnapshotTagContext(ctx context.Context, id int64, tag string) error {
+	res, err := s.writer.ExecContext(ctx, `UPDATE snapshots SET tag = ? WHERE id = ?`, tag, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListSnapshotsByTagContext is ListSnapshotSummaries restricted to the
+// snapshots tagged tag. Empty country or chart match all values.
+func (s *Store) ListSnapshotsByTagContext(ctx context.Context, country, chart, tag string) ([]SnapshotSummary, error) {
+	name, genre := SplitChartKey(chart)
+	summaries, _, err := s.listSnapshotSummaries(ctx,
+		`tag = ? AND (? = '' OR country = ?) AND (? = '' OR (chart = ? AND genre = ?))`,
+		[]any{tag, country, country, chart, name, genre},
+		0, 0,
+	)
+	return summaries, err
+}
@@ -0,0 +1,77 @@
+package store
+
+import "context"
+
+// SnapshotIntegrity pairs a snapshot with the number of items actually
+// stored for it, so damaged rows can be found.
+type SnapshotIntegrity struct {
+	Snapshot
+	ItemCount int
+}
+
+// Checked reports whether the snapshot recorded how many items it expected.
+// Older snapshots did not, and are only flagged when they have no items.
+func (i SnapshotIntegrity) Checked() bool {
+	return i.ExpectedItems.Valid
+}
+
+// Partial reports whether the snapshot lost items to an interrupted insert:
+// fewer stored than the fetch meant to store. Short feeds, repeated apps
+// and apps dropped by ignore_patterns at fetch are already left out of the
+// expected count, so they are not partial.
+func (i SnapshotIntegrity) Partial() bool {
+	if !i.Checked() {
+		return i.ItemCount == 0
+	}
+	return i.ItemCount < i.ExpectedItems.Value
+}
+
+// OK reports whether the snapshot holds the items it was stored with.
+func (i SnapshotIntegrity) OK() bool {
+	if !i.Checked() {
+		return i.ItemCount > 0
+	}
+	return i.ItemCount == i.ExpectedItems.Value
+}
+
+// SnapshotIntegrityContext returns the integrity summary of every snapshot
+// for country and chart, oldest first; empty country or chart matches all.
+func (s *Store) SnapshotIntegrityContext(ctx context.Context, country, chart string) ([]SnapshotIntegrity, error) {
+	name, genre := SplitChartKey(chart)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+snapshotColumns+`,
+		   (SELECT COUNT(*) FROM chart_items WHERE chart_items.snapshot_id = snapshots.id)
+		 FROM snapshots
+		 WHERE (? = '' OR country = ?) AND (? = '' OR (chart = ? AND genre = ?))
+		 ORDER BY collected_at ASC, id ASC`,
+		country, country, chart, name, genre,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SnapshotIntegrity
+	for rows.Next() {
+		var result SnapshotIntegrity
+		result.Snapshot, err = scanSnapshot(extraScanner{rows, []any{&result.ItemCount}})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// extraScanner scans the snapshot columns followed by extra columns.
+type extraScanner struct {
+	row    rowScanner
+	extras []any
+}
+
+func (e extraScanner) Scan(dest ...any) error {
+	return e.row.Scan(append(dest, e.extras...)...)
+}
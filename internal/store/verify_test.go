@@ -0,0 +1,47 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshotIntegrity(t *testing.T) {
+	st, _ := openTestStore(t)
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshot := func(expected NullInt) Snapshot {
+		at = at.Add(time.Hour)
+		s := testSnapshot("kr", "top-free", at)
+		s.Limit = 5
+		s.ExpectedItems = expected
+		return s
+	}
+	// Ranks 1, 2 and 4: an editorial feed one short of the limit with a
+	// repeated app dropped at rank 3, stored in full.
+	complete := insertTestSnapshot(t, st, snapshot(NullableInt(3)), []ChartItem{{Rank: 1, AppID: "a"}, {Rank: 2, AppID: "b"}, {Rank: 4, AppID: "c"}})
+	// Meant to store four items but only two made it.
+	partial := insertTestSnapshot(t, st, snapshot(NullableInt(4)), []ChartItem{{Rank: 1, AppID: "a"}, {Rank: 2, AppID: "b"}})
+	// Stored before the expected count was recorded.
+	legacy := insertTestSnapshot(t, st, snapshot(NullInt{}), []ChartItem{{Rank: 1, AppID: "a"}})
+	legacyEmpty := insertTestSnapshot(t, st, snapshot(NullInt{}), nil)
+
+	results, err := st.SnapshotIntegrity("kr", "top-free")
+	if err != nil {
+		t.Fatalf("SnapshotIntegrity: %v", err)
+	}
+	want := map[int64]struct{ ok, partial, checked bool }{
+		complete:    {true, false, true},
+		partial:     {false, true, true},
+		legacy:      {true, false, false},
+		legacyEmpty: {false, true, false},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for _, result := range results {
+		w := want[result.ID]
+		if result.OK() != w.ok || result.Partial() != w.partial || result.Checked() != w.checked {
+			t.Errorf("snapshot %d (%d items): OK/Partial/Checked = %v/%v/%v, want %v/%v/%v",
+				result.ID, result.ItemCount, result.OK(), result.Partial(), result.Checked(), w.ok, w.partial, w.checked)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+// Package version identifies this build of app_download_analyzer.
+package version
+
+const (
+	// Name is the tool's name as it appears in output and request headers.
+	Name = "app_download_analyzer"
+	// Version is the tool's release version.
+	Version = "1.0"
+	// String is Name/Version, used as the User-Agent of outgoing requests
+	// and as generated_by in JSON output.
+	String = Name + "/" + Version
+)